@@ -3,51 +3,511 @@ package main
 import (
 	"redis-failover-lab/pkg"
 
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
-	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
 
 func main() {
 	pulumi.Run(func(ctx *pulumi.Context) error {
-		cfg := config.New(ctx, "")
+		// Load and validate the whole config before creating any resources
+		cfg, err := pkg.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		// Pinned provider versions must match the ones the program was built with
+		if err := pkg.ValidateProviderVersions(cfg); err != nil {
+			return err
+		}
+		providerVersions, err := pkg.ProviderVersions()
+		if err != nil {
+			return err
+		}
+		ctx.Export("providerVersions", pulumi.ToStringMap(providerVersions))
+		resolvedConfig, err := cfg.ResolvedConfig()
+		if err != nil {
+			return err
+		}
+		ctx.Export("resolvedConfig", pulumi.ToMap(resolvedConfig))
+		ctx.Export("runId", pulumi.String(cfg.RunId))
 
-		// Get configuration values
-		vpcId := cfg.Require("vpcId")
-		eksSecurityGroupId := cfg.Require("eksSecurityGroupId")
-		redisSecurityGroupId := cfg.Require("redisSecurityGroupId")
+		// Every AWS resource and lookup goes through this provider, pinned to cfg.Region
+		awsProvider, err := pkg.NewAwsProvider(ctx, cfg)
+		if err != nil {
+			return err
+		}
 
-		// Get private subnet IDs
-		privateSubnetIds := cfg.RequireObject("privateSubnetIds").([]interface{})
-		subnetIds := make([]string, len(privateSubnetIds))
-		for i, id := range privateSubnetIds {
-			subnetIds[i] = id.(string)
+		// A monitoring-only stack watches the cluster of another lab stack and creates
+		// nothing else
+		if cfg.MonitoringSourceStackRef != "" {
+			return monitorSourceStack(ctx, awsProvider, cfg)
+		}
+
+		// Rough cost estimate, computed before anything is created
+		// The lab stack uses existing subnets and creates no NAT gateways
+		costEstimate, err := pkg.EstimateMonthlyCost(cfg, 0)
+		if err != nil {
+			return err
+		}
+		ctx.Export("estimatedMonthlyCost", pulumi.Map{
+			"totalUsd":  pulumi.Float64(costEstimate.TotalUsd),
+			"breakdown": pulumi.ToFloat64Map(costEstimate.Breakdown),
+			"unpriced":  pulumi.ToStringArray(costEstimate.Unpriced),
+			"note":      pulumi.String(costEstimate.Note),
+		})
+
+		// Advisory reserved-node sizing for long-running labs; nothing is purchased
+		reservedNodes, unreserved, err := pkg.RecommendReservedNodes(cfg)
+		if err != nil {
+			return err
+		}
+		reservedNodeOutputs := pulumi.Array{}
+		for _, r := range reservedNodes {
+			reservedNodeOutputs = append(reservedNodeOutputs, pulumi.Map{
+				"reservedNodeType": pulumi.String(r.ReservedNodeType),
+				"count":            pulumi.Int(r.Count),
+				"covers":           pulumi.ToStringArray(r.Covers),
+			})
+		}
+		ctx.Export("reservedNodeRecommendation", pulumi.Map{
+			"recommendations": reservedNodeOutputs,
+			"unpriced":        pulumi.ToStringArray(unreserved),
+			"note":            pulumi.String("Advisory: reserved nodes (redis, size-flexible within a family) that would cover the lab's nodes; nothing is purchased"),
+		})
+
+		// Per-service subnets must belong to the VPC
+		if err := pkg.ValidateSubnetsInVpc(ctx, awsProvider, cfg.VpcId, "eksSubnetIds", cfg.EksSubnetIds); err != nil {
+			return err
+		}
+		if err := pkg.ValidateSubnetsInVpc(ctx, awsProvider, cfg.VpcId, "redisSubnetIds", cfg.RedisSubnetIds); err != nil {
+			return err
 		}
 
 		// Create EKS cluster
-		eksResult, err := pkg.CreateEKSCluster(ctx, vpcId, subnetIds, eksSecurityGroupId)
+		eksResult, err := pkg.CreateEKSCluster(ctx, awsProvider, cfg)
 		if err != nil {
 			return err
 		}
 
-		// Create ElastiCache Redis cluster
-		elasticacheResult, err := pkg.CreateElastiCacheCluster(ctx, subnetIds, redisSecurityGroupId)
+		// Optional post-provision wait for schedulable nodes, for automated tests
+		if cfg.WaitForEksNodes {
+			eksReadyResult, err := pkg.WaitForEksNodes(ctx, awsProvider, cfg, eksResult)
+			if err != nil {
+				return err
+			}
+			ctx.Export("eksReady", eksReadyResult.Status)
+		}
+
+		// Optional dedicated subnets isolating ElastiCache from EKS
+		var elasticacheSubnets *pkg.ElasticacheSubnetsResult
+		if cfg.CreateElasticacheSubnets {
+			elasticacheSubnets, err = pkg.CreateElasticacheSubnets(ctx, awsProvider, cfg)
+			if err != nil {
+				return err
+			}
+			ctx.Export("elasticacheSubnetIds", elasticacheSubnets.SubnetIds)
+		}
+
+		// Create ElastiCache Redis clusters, keyed for side-by-side comparison
+		clusterOutputs := pulumi.Map{}
+		var scalingPolicyArns pulumi.StringArray
+		var elasticacheResult *pkg.ElastiCacheResult
+		var initialSnapshotName pulumi.StringInput
+		var preDestroySnapshotPrefix pulumi.StringInput
+		var nodeReplacementMemberClusterId pulumi.StringInput
+		var nodeReplacementNewMemberClusterId pulumi.StringInput
+		var failoverStartTime pulumi.StringInput
+		var expectedPromotionOrder pulumi.MapOutput
+		var tlsEndpoint pulumi.MapOutput
+		elasticacheResults := map[string]*pkg.ElastiCacheResult{}
+		for _, cluster := range cfg.Clusters {
+			result, err := pkg.CreateElastiCacheCluster(ctx, awsProvider, cfg, cluster, elasticacheSubnets, cfg.ReplicaOverrides)
+			if err != nil {
+				return err
+			}
+			if cfg.CacheAutoScaling {
+				scalingResult, err := pkg.CreateCacheAutoScaling(ctx, awsProvider, cluster.Key, result.ReplicationGroupId, cfg)
+				if err != nil {
+					return err
+				}
+				scalingPolicyArns = append(scalingPolicyArns, scalingResult.PolicyArns...)
+			}
+			promotionOrder := pkg.ExpectedPromotionOrder(ctx, awsProvider, result)
+			tlsEndpointResult, err := pkg.CreateTlsEndpointRecord(ctx, awsProvider, cluster.Key, result)
+			if err != nil {
+				return err
+			}
+			clusterOutput := pulumi.Map{
+				"configurationEndpoint":  result.ConfigurationEndpoint,
+				"replicationGroupId":     result.ReplicationGroupId,
+				"replicationGroupArn":    result.ReplicationGroupArn,
+				"primaryAz":              result.PrimaryAz,
+				"primaryPlacement":       result.PrimaryPlacement,
+				"clientConfig":           result.ClientConfig,
+				"configDiff":             result.ConfigDiff,
+				"expectedPromotionOrder": promotionOrder,
+				"tlsEndpoint":            tlsEndpointResult.Endpoint,
+				"tlsEndpointParameter":   tlsEndpointResult.ParameterName,
+			}
+			if cfg.CreateInitialSnapshot {
+				snapshotResult, err := pkg.CreateInitialSnapshot(ctx, awsProvider, cluster.Key, result.ReplicationGroupId, cfg.InitialSnapshotName)
+				if err != nil {
+					return err
+				}
+				clusterOutput["initialSnapshotName"] = snapshotResult.SnapshotName
+				if initialSnapshotName == nil {
+					initialSnapshotName = snapshotResult.SnapshotName
+				}
+			}
+			if cfg.HealthGate {
+				gateResult, err := pkg.CreateClusterHealthGate(ctx, awsProvider, cfg, cluster.Key, result)
+				if err != nil {
+					return err
+				}
+				clusterOutput["healthGate"] = gateResult.Status
+			}
+			if cfg.ConnectionLogging {
+				clusterOutput["engineLogGroup"] = result.EngineLogGroupName
+			}
+			if cfg.SeparateRedisLogGroups {
+				clusterOutput["slowLogGroup"] = result.SlowLogGroupName
+			}
+			if cfg.NodeReplacementShard > 0 {
+				replacementResult, err := pkg.SimulateNodeReplacement(ctx, awsProvider, cfg, cluster.Key, result)
+				if err != nil {
+					return err
+				}
+				clusterOutput["nodeReplacement"] = replacementResult.Result
+				if nodeReplacementMemberClusterId == nil {
+					nodeReplacementMemberClusterId = replacementResult.MemberClusterId
+					nodeReplacementNewMemberClusterId = replacementResult.ReplacementMemberClusterId
+				}
+			}
+			if cfg.TriggerFailoverOnDeploy {
+				failoverResult, err := pkg.TriggerFailoverOnDeploy(ctx, awsProvider, cfg, cluster.Key, result)
+				if err != nil {
+					return err
+				}
+				clusterOutput["failoverStartTime"] = failoverResult.StartTime
+				if failoverStartTime == nil {
+					failoverStartTime = failoverResult.StartTime
+				}
+			}
+			if cfg.BackupBeforeDestroy {
+				backupResult, err := pkg.CreatePreDestroySnapshot(ctx, awsProvider, cluster.Key, result.ReplicationGroupId)
+				if err != nil {
+					return err
+				}
+				clusterOutput["preDestroySnapshotPrefix"] = pulumi.String(backupResult.SnapshotNamePrefix)
+				if preDestroySnapshotPrefix == nil {
+					preDestroySnapshotPrefix = pulumi.String(backupResult.SnapshotNamePrefix)
+				}
+			}
+			clusterOutputs[cluster.Key] = clusterOutput
+			elasticacheResults[cluster.Key] = result
+			// The first cluster backs the dashboard and the single-cluster outputs
+			if elasticacheResult == nil {
+				elasticacheResult = result
+				expectedPromotionOrder = promotionOrder
+				tlsEndpoint = tlsEndpointResult.Endpoint
+			}
+		}
+
+		// Record the TLS policy the endpoints negotiate
+		tlsPolicyResult, err := pkg.CreateTlsPolicyRecord(ctx, awsProvider, cfg)
 		if err != nil {
 			return err
 		}
 
 		// Create CloudWatch monitoring
-		_, err = pkg.CreateMonitoring(ctx, elasticacheResult.ReplicationGroupId)
+		monitoringResult, err := pkg.CreateMonitoring(ctx, awsProvider, &pkg.MonitoringSource{
+			ReplicationGroupId: elasticacheResult.ReplicationGroupId,
+			ShardReplicas:      elasticacheResult.ShardReplicas,
+			EksClusterName:     eksResult.ClusterName,
+			RunId:              cfg.RunId,
+		}, cfg)
 		if err != nil {
 			return err
 		}
 
+		// Optional scheduled summary of each test run, sent to the alarm topic
+		if cfg.FailoverReportSchedule != "" {
+			reportResult, err := pkg.CreateFailoverReport(ctx, awsProvider, cfg, elasticacheResult.ReplicationGroupId, monitoringResult.AlarmTopicArn, cfg.RunId)
+			if err != nil {
+				return err
+			}
+			ctx.Export("failoverReportFunction", reportResult.FunctionName)
+		}
+
+		// Optional Grafana datasource definition for the lab's metrics
+		if cfg.GrafanaWorkspaceRegion != "" {
+			grafanaResult, err := pkg.ExportGrafanaDatasource(ctx, elasticacheResult.ReplicationGroupId, elasticacheResult.ShardReplicas, cfg.Region, cfg.GrafanaWorkspaceRegion, cfg.RunId)
+			if err != nil {
+				return err
+			}
+			ctx.Export("grafanaDatasourceParameter", grafanaResult.ParameterName)
+		}
+
+		// Optional scrape configuration for existing Prometheus setups
+		if cfg.ExportPrometheusScrapeConfig {
+			scrapeResult, err := pkg.ExportPrometheusScrapeConfig(ctx, awsProvider, elasticacheResult.ReplicationGroupId, elasticacheResult.ShardReplicas)
+			if err != nil {
+				return err
+			}
+			ctx.Export("prometheusScrapeConfigParameter", scrapeResult.ParameterName)
+		}
+
+		// Optional in-cluster workloads
+		var k8sProvider *kubernetes.Provider
+		if cfg.DeployRedisExporter || cfg.DeployApp || cfg.DeployFailoverObserver || cfg.SeedData {
+			k8sProvider, err = pkg.NewKubernetesProvider(ctx, eksResult.Kubeconfig)
+			if err != nil {
+				return err
+			}
+		}
+		var observabilityNamespace *corev1.Namespace
+		if cfg.DeployRedisExporter || cfg.DeployFailoverObserver || cfg.SeedData {
+			observabilityNamespace, err = pkg.CreateObservabilityNamespace(ctx, k8sProvider)
+			if err != nil {
+				return err
+			}
+		}
+		// The app connects through the seeded endpoint so it starts on the seeded dataset
+		appRedisEndpoint := elasticacheResult.ConfigurationEndpoint
+		if cfg.SeedData {
+			seedResult, err := pkg.DeploySeedDataJob(ctx, k8sProvider, observabilityNamespace, elasticacheResult.ConfigurationEndpoint, *cfg.Encryption, cfg.SeedKeyCount)
+			if err != nil {
+				return err
+			}
+			appRedisEndpoint = seedResult.RedisEndpoint
+			ctx.Export("seedJob", seedResult.JobName)
+		}
+		var appNamespace pulumi.StringInput
+		if cfg.DeployApp {
+			var appMetricsRoleArn pulumi.StringInput
+			if cfg.AppMetricsRole {
+				appMetricsRoleArn = eksResult.AppMetricsRoleArn
+			}
+			appResult, err := pkg.DeployFailoverApp(ctx, k8sProvider, cfg, appRedisEndpoint, appMetricsRoleArn)
+			if err != nil {
+				return err
+			}
+			ctx.Export("appNamespace", appResult.Namespace)
+			appNamespace = appResult.Namespace
+
+			if cfg.CreateConnectionConfigMap {
+				configMapResult, err := pkg.CreateConnectionConfigMap(ctx, k8sProvider, appResult.Namespace, elasticacheResult)
+				if err != nil {
+					return err
+				}
+				ctx.Export("connectionConfigMap", configMapResult.Name)
+			}
+
+			if cfg.DeployChaosExperiment {
+				chaosResult, err := pkg.DeployChaosExperiment(ctx, awsProvider, k8sProvider, appResult.Namespace, elasticacheResult, cfg.ChaosPartitionDuration)
+				if err != nil {
+					return err
+				}
+				ctx.Export("chaosExperiment", chaosResult.ExperimentName)
+			}
+		}
+		// Optional Lettuce configuration for Spring Boot, in the app namespace when deployed
+		if cfg.ExportLettuceConfig {
+			lettuceResult, err := pkg.ExportLettuceConfig(ctx, k8sProvider, appNamespace, cfg, elasticacheResult)
+			if err != nil {
+				return err
+			}
+			ctx.Export("lettuceApplicationYaml", lettuceResult.ApplicationYaml)
+			if appNamespace != nil {
+				ctx.Export("lettuceConfigMap", lettuceResult.ConfigMapName)
+			}
+		}
+		if cfg.DeployRedisExporter {
+			exporterResult, err := pkg.DeployRedisExporter(ctx, k8sProvider, observabilityNamespace, elasticacheResult.ConfigurationEndpoint, *cfg.Encryption)
+			if err != nil {
+				return err
+			}
+			ctx.Export("redisExporterService", exporterResult.ServiceName)
+		}
+		if cfg.DeployPrometheusStack {
+			prometheusResult, err := pkg.DeployPrometheusStack(ctx, k8sProvider, observabilityNamespace)
+			if err != nil {
+				return err
+			}
+			ctx.Export("grafanaService", pulumi.Map{
+				"address":     prometheusResult.GrafanaService,
+				"adminSecret": prometheusResult.GrafanaAdminSecret,
+			})
+		}
+		if cfg.DeployFailoverObserver {
+			observerResult, err := pkg.DeployFailoverObserver(ctx, k8sProvider, observabilityNamespace, elasticacheResult.ConfigurationEndpoint, *cfg.Encryption, cfg.Region, cfg.RunId)
+			if err != nil {
+				return err
+			}
+			ctx.Export("failoverObserverDeployment", observerResult.DeploymentName)
+		}
+
+		// Alarms rolled up into the lab health composite alarm
+		var healthAlarmArns pulumi.StringArray
+
+		// Optional EKS node health alarms
+		if cfg.EksMonitoring {
+			eksMonitoringResult, err := pkg.CreateEksMonitoring(ctx, awsProvider, cfg, eksResult.ClusterName, eksResult.NodeRoleName, monitoringResult.AlarmTopicArn)
+			if err != nil {
+				return err
+			}
+			healthAlarmArns = append(healthAlarmArns, eksMonitoringResult.AlarmArns...)
+			ctx.Export("eksAlarmArns", eksMonitoringResult.AlarmArns)
+		}
+
+		// Optional blackbox health check of the app
+		if cfg.CreateCanary {
+			canaryResult, err := pkg.CreateCanary(ctx, awsProvider, cfg, cfg.CanaryUrl, cfg.EksSubnetIds, cfg.EksSecurityGroupId)
+			if err != nil {
+				return err
+			}
+			healthAlarmArns = append(healthAlarmArns, canaryResult.AlarmArn)
+			ctx.Export("canaryName", canaryResult.CanaryName)
+		}
+
+		// Optional copy of the lab's metrics in S3
+		if cfg.MetricStream {
+			metricStreamResult, err := pkg.CreateMetricStream(ctx, awsProvider, cfg)
+			if err != nil {
+				return err
+			}
+			ctx.Export("metricStreamArn", metricStreamResult.StreamArn)
+			ctx.Export("metricStreamBucketArn", metricStreamResult.BucketArn)
+		}
+
+		if len(healthAlarmArns) > 0 {
+			labHealthResult, err := pkg.CreateLabHealthAlarm(ctx, awsProvider, cfg, healthAlarmArns, monitoringResult.AlarmTopicArn)
+			if err != nil {
+				return err
+			}
+			ctx.Export("labHealthAlarmArn", labHealthResult.AlarmArn)
+		}
+
+		// Optional read-only role for observers
+		if cfg.ObserverPrincipalArn != "" {
+			observerResult, err := pkg.CreateObserverRole(ctx, awsProvider, cfg.ObserverPrincipalArn)
+			if err != nil {
+				return err
+			}
+			ctx.Export("observerRoleArn", observerResult.RoleArn)
+		}
+
+		// Optional notification when the stack is destroyed
+		if cfg.TeardownWebhookUrl != "" {
+			if err := pkg.CreateTeardownNotifier(ctx, awsProvider, cfg.TeardownWebhookUrl); err != nil {
+				return err
+			}
+		}
+
 		// Export outputs
 		ctx.Export("eksClusterName", eksResult.ClusterName)
 		ctx.Export("eksClusterEndpoint", eksResult.ClusterEndpoint)
 		ctx.Export("kubeconfig", eksResult.Kubeconfig)
+		ctx.Export("eksAuthenticationMode", pulumi.String(eksResult.AuthenticationMode))
+		ctx.Export("eksNodeGroupType", pulumi.String(eksResult.NodeGroupType))
+		if cfg.Adot {
+			ctx.Export("adotAddonVersion", eksResult.AdotAddonVersion)
+			ctx.Export("adotCollectorRoleArn", eksResult.AdotCollectorRoleArn)
+		}
+		if cfg.AppMetricsRole {
+			ctx.Export("appMetricsRoleArn", eksResult.AppMetricsRoleArn)
+		}
+		if cfg.CiRoleArn != "" {
+			ctx.Export("ciAccessEntryArn", eksResult.CiAccessEntryArn)
+		}
+		// Flag chaos tooling flips to move the app into read-only or degraded mode
+		maintenanceModeResult, err := pkg.CreateMaintenanceModeParameter(ctx, awsProvider)
+		if err != nil {
+			return err
+		}
+
+		ctx.Export("securityGroupMapping", pkg.SecurityGroupMapping(cfg, eksResult))
 		ctx.Export("redisClusterEndpoint", elasticacheResult.ConfigurationEndpoint)
 		ctx.Export("redisReplicationGroupId", elasticacheResult.ReplicationGroupId)
+		ctx.Export("redisReplicationGroupArn", elasticacheResult.ReplicationGroupArn)
+		ctx.Export("redisPrimaryAz", elasticacheResult.PrimaryAz)
+		ctx.Export("redisPrimaryPlacement", elasticacheResult.PrimaryPlacement)
+		// Read by monitoring-only stacks to plan their per-shard alarms
+		ctx.Export("redisShardReplicas", pulumi.ToIntArray(elasticacheResult.ShardReplicas))
+		if cfg.LocalZone != "" {
+			ctx.Export("redisLocalZone", pulumi.String(cfg.LocalZone))
+		}
+		ctx.Export("expectedPromotionOrder", expectedPromotionOrder)
+		ctx.Export("redisClientConfig", elasticacheResult.ClientConfig)
+		ctx.Export("configDiff", elasticacheResult.ConfigDiff)
+		ctx.Export("redisClusters", clusterOutputs)
+		if cfg.CreateInitialSnapshot {
+			ctx.Export("redisInitialSnapshotName", initialSnapshotName)
+		}
+		if cfg.BackupBeforeDestroy {
+			ctx.Export("redisPreDestroySnapshotPrefix", preDestroySnapshotPrefix)
+		}
+		if cfg.NodeReplacementShard > 0 {
+			ctx.Export("nodeReplacementMemberClusterId", nodeReplacementMemberClusterId)
+			ctx.Export("nodeReplacementNewMemberClusterId", nodeReplacementNewMemberClusterId)
+		}
+		if cfg.TriggerFailoverOnDeploy {
+			ctx.Export("failoverStartTime", failoverStartTime)
+		}
+		ctx.Export("redisTlsPolicy", pulumi.String(tlsPolicyResult.Policy))
+		ctx.Export("redisTlsPolicyParameter", tlsPolicyResult.ParameterName)
+		ctx.Export("redisTlsEndpoint", tlsEndpoint)
+		ctx.Export("maintenanceModeParameter", maintenanceModeResult.ParameterName)
+		if cfg.CacheAutoScaling {
+			ctx.Export("cacheAutoScalingPolicyArns", scalingPolicyArns)
+		}
+		ctx.Export("alarmTopicArn", monitoringResult.AlarmTopicArn)
+		ctx.Export("failedOpsAlarmArn", monitoringResult.FailedOpsAlarmArn)
+		if cfg.ShardAlarms {
+			ctx.Export("shardAlarmArns", monitoringResult.ShardAlarmArns)
+			ctx.Export("shardsAlarmArn", monitoringResult.ShardsAlarmArn)
+		}
+		if cfg.EmitGrafanaDashboard {
+			ctx.Export("grafanaDashboardJson", monitoringResult.GrafanaDashboard)
+		}
+		if cfg.EmitImportList {
+			ctx.Export("importList", pkg.ImportList(cfg, eksResult, elasticacheResults, monitoringResult, maintenanceModeResult))
+		}
 
 		return nil
 	})
 }
+
+// monitorSourceStack creates the dashboard, alarms and optional failover report for
+// the cluster of the lab stack cfg.MonitoringSourceStackRef
+func monitorSourceStack(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *pkg.LabConfig) error {
+	source, err := pkg.MonitoringSourceFromStack(ctx, cfg.MonitoringSourceStackRef)
+	if err != nil {
+		return err
+	}
+	monitoringResult, err := pkg.CreateMonitoring(ctx, awsProvider, source, cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.FailoverReportSchedule != "" {
+		reportResult, err := pkg.CreateFailoverReport(ctx, awsProvider, cfg, source.ReplicationGroupId, monitoringResult.AlarmTopicArn, source.RunId)
+		if err != nil {
+			return err
+		}
+		ctx.Export("failoverReportFunction", reportResult.FunctionName)
+	}
+
+	ctx.Export("monitoredReplicationGroupId", monitoringResult.ReplicationGroupId)
+	ctx.Export("monitoredRunId", pulumi.String(source.RunId))
+	ctx.Export("alarmTopicArn", monitoringResult.AlarmTopicArn)
+	ctx.Export("failedOpsAlarmArn", monitoringResult.FailedOpsAlarmArn)
+	if cfg.ShardAlarms {
+		ctx.Export("shardAlarmArns", monitoringResult.ShardAlarmArns)
+		ctx.Export("shardsAlarmArn", monitoringResult.ShardsAlarmArn)
+	}
+	if cfg.EmitGrafanaDashboard {
+		ctx.Export("grafanaDashboardJson", monitoringResult.GrafanaDashboard)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package pkg
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	appsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// appNamespace holds the stack-managed failover app, separate from the
+// redis-failover-lab namespace used by the kubectl-applied manifests
+const appNamespace = "redis-failover-lab-app"
+
+// appServiceAccountName is the app's service account, bound to the app metrics role
+// when cfg.AppMetricsRole is true
+const appServiceAccountName = "redis-failover-app"
+
+// waitForRedisScript blocks until the Redis endpoint accepts TCP/TLS connections,
+// matching the wait-for-redis init container in k8s/deployments
+const waitForRedisScript = `host="${REDIS_CLUSTER_ENDPOINT%:*}"
+port="${REDIS_CLUSTER_ENDPOINT##*:}"
+deadline=$(( $(date +%s) + REDIS_WAIT_TIMEOUT_SECONDS ))
+until
+  if [ "$REDIS_SSL_ENABLED" = "true" ]; then
+    openssl s_client -connect "$host:$port" -servername "$host" </dev/null >/dev/null 2>&1
+  else
+    nc -z -w 5 "$host" "$port"
+  fi
+do
+  if [ "$(date +%s)" -ge "$deadline" ]; then
+    echo "Redis at $host:$port not reachable after ${REDIS_WAIT_TIMEOUT_SECONDS}s"
+    exit 1
+  fi
+  echo "Waiting for Redis at $host:$port"
+  sleep 5
+done
+`
+
+// appConnectionEnv names the variables the stack injects into the app so it can
+// reach Redis, and tag its metrics with the RunId dimension the dashboards and
+// alarms filter on; appEnv may not override them. The lab cluster has no auth token
+var appConnectionEnv = map[string]bool{
+	"REDIS_CLUSTER_ENDPOINT": true,
+	"REDIS_HOST":             true,
+	"REDIS_PORT":             true,
+	"REDIS_SSL_ENABLED":      true,
+	"REDIS_AUTH_ENABLED":     true,
+	"LAB_RUN_ID":             true,
+}
+
+type FailoverAppResult struct {
+	Namespace      pulumi.StringOutput
+	DeploymentName pulumi.StringOutput
+}
+
+type ConnectionConfigMapResult struct {
+	Name pulumi.StringOutput
+}
+
+// appDefaultEnv configures the app's workloads unless overridden through appEnv
+var appDefaultEnv = [][2]string{
+	{"WORKLOAD_MODE", "both"},
+	{"WORKLOAD_TYPES", "getset,pubsub,streams"},
+	{"LETTUCE_PROFILE", "aws-recommended"},
+	{"CLOUDWATCH_ENABLED", "true"},
+	{"MAINTENANCE_MODE_PARAMETER", maintenanceModeParameterName},
+}
+
+// appEnv returns the injected Redis connection variables, the app defaults with
+// cfg.AppEnv overrides applied, then the remaining cfg.AppEnv entries sorted by name
+// Names stay unique, as server-side apply rejects duplicate env entries
+func appEnv(cfg *LabConfig, redisEndpoint pulumi.StringOutput) corev1.EnvVarArray {
+	env := corev1.EnvVarArray{
+		&corev1.EnvVarArgs{Name: pulumi.String("REDIS_CLUSTER_ENDPOINT"), Value: pulumi.Sprintf("%s:6379", redisEndpoint)},
+		&corev1.EnvVarArgs{Name: pulumi.String("REDIS_HOST"), Value: redisEndpoint},
+		&corev1.EnvVarArgs{Name: pulumi.String("REDIS_PORT"), Value: pulumi.String("6379")},
+		&corev1.EnvVarArgs{Name: pulumi.String("REDIS_SSL_ENABLED"), Value: pulumi.String(strconv.FormatBool(*cfg.Encryption))},
+		&corev1.EnvVarArgs{Name: pulumi.String("REDIS_AUTH_ENABLED"), Value: pulumi.String("false")},
+		&corev1.EnvVarArgs{Name: pulumi.String("LAB_RUN_ID"), Value: pulumi.String(cfg.RunId)},
+	}
+	used := map[string]bool{}
+	for _, entry := range appDefaultEnv {
+		name, value := entry[0], entry[1]
+		if override, ok := cfg.AppEnv[name]; ok {
+			value = override
+		}
+		used[name] = true
+		env = append(env, &corev1.EnvVarArgs{Name: pulumi.String(name), Value: pulumi.String(value)})
+	}
+	names := make([]string, 0, len(cfg.AppEnv))
+	for name := range cfg.AppEnv {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, &corev1.EnvVarArgs{Name: pulumi.String(name), Value: pulumi.String(cfg.AppEnv[name])})
+	}
+	return env
+}
+
+// DeployFailoverApp deploys cfg.AppReplicas pods of the failover app running both
+// producer and consumer workloads against redisEndpoint. Pods are spread across AZs
+// and kept on distinct nodes so failover is observed by a distributed client fleet.
+// A non-nil metricsRoleArn runs the pods as a service account bound to that IRSA role
+func DeployFailoverApp(ctx *pulumi.Context, provider *kubernetes.Provider, cfg *LabConfig, redisEndpoint pulumi.StringOutput, metricsRoleArn pulumi.StringInput) (*FailoverAppResult, error) {
+	namespace, err := corev1.NewNamespace(ctx, appNamespace, &corev1.NamespaceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name: pulumi.String(appNamespace),
+			Labels: pulumi.StringMap{
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name":    pulumi.String("redis-failover-app"),
+		"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+	}
+	endpoint := pulumi.Sprintf("%s:6379", redisEndpoint)
+
+	var serviceAccountName pulumi.StringPtrInput
+	if metricsRoleArn != nil {
+		serviceAccount, err := corev1.NewServiceAccount(ctx, appServiceAccountName, &corev1.ServiceAccountArgs{
+			Metadata: &metav1.ObjectMetaArgs{
+				Name:      pulumi.String(appServiceAccountName),
+				Namespace: namespace.Metadata.Name(),
+				Labels:    labels,
+				Annotations: pulumi.StringMap{
+					"eks.amazonaws.com/role-arn": metricsRoleArn,
+				},
+			},
+		}, pulumi.Provider(provider))
+		if err != nil {
+			return nil, err
+		}
+		serviceAccountName = serviceAccount.Metadata.Name()
+	}
+
+	deployment, err := appsv1.NewDeployment(ctx, "redis-failover-app", &appsv1.DeploymentArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-failover-app"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Spec: &appsv1.DeploymentSpecArgs{
+			Replicas: pulumi.Int(cfg.AppReplicas),
+			Selector: &metav1.LabelSelectorArgs{
+				MatchLabels: labels,
+			},
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: labels,
+				},
+				Spec: &corev1.PodSpecArgs{
+					ServiceAccountName: serviceAccountName,
+					// Spread across AZs, and never two pods on one node
+					TopologySpreadConstraints: corev1.TopologySpreadConstraintArray{
+						&corev1.TopologySpreadConstraintArgs{
+							MaxSkew:           pulumi.Int(1),
+							TopologyKey:       pulumi.String("topology.kubernetes.io/zone"),
+							WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
+							LabelSelector: &metav1.LabelSelectorArgs{
+								MatchLabels: labels,
+							},
+						},
+					},
+					Affinity: &corev1.AffinityArgs{
+						PodAntiAffinity: &corev1.PodAntiAffinityArgs{
+							RequiredDuringSchedulingIgnoredDuringExecution: corev1.PodAffinityTermArray{
+								&corev1.PodAffinityTermArgs{
+									TopologyKey: pulumi.String("kubernetes.io/hostname"),
+									LabelSelector: &metav1.LabelSelectorArgs{
+										MatchLabels: labels,
+									},
+								},
+							},
+						},
+					},
+					InitContainers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:    pulumi.String("wait-for-redis"),
+							Image:   pulumi.String(cfg.AppInitImage),
+							Command: pulumi.StringArray{pulumi.String("/bin/sh"), pulumi.String("-c"), pulumi.String(waitForRedisScript)},
+							Env: corev1.EnvVarArray{
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_CLUSTER_ENDPOINT"), Value: endpoint},
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_SSL_ENABLED"), Value: pulumi.String(strconv.FormatBool(*cfg.Encryption))},
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_WAIT_TIMEOUT_SECONDS"), Value: pulumi.String(strconv.Itoa(cfg.RedisWaitTimeoutSeconds))},
+							},
+						},
+					},
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:            pulumi.String("redis-failover-app"),
+							Image:           pulumi.String(cfg.AppImage),
+							ImagePullPolicy: pulumi.String("Always"),
+							Ports: corev1.ContainerPortArray{
+								&corev1.ContainerPortArgs{
+									Name:          pulumi.String("http"),
+									ContainerPort: pulumi.Int(8080),
+								},
+							},
+							Args: pulumi.ToStringArray(cfg.AppArgs),
+							Env:  appEnv(cfg, redisEndpoint),
+							Resources: &corev1.ResourceRequirementsArgs{
+								Requests: pulumi.StringMap{
+									"memory": pulumi.String("512Mi"),
+									"cpu":    pulumi.String("250m"),
+								},
+								Limits: pulumi.StringMap{
+									"memory": pulumi.String("1Gi"),
+									"cpu":    pulumi.String("500m"),
+								},
+							},
+							LivenessProbe: &corev1.ProbeArgs{
+								HttpGet: &corev1.HTTPGetActionArgs{
+									Path: pulumi.String("/actuator/health/liveness"),
+									Port: pulumi.Int(8080),
+								},
+								InitialDelaySeconds: pulumi.Int(30),
+								PeriodSeconds:       pulumi.Int(10),
+							},
+							ReadinessProbe: &corev1.ProbeArgs{
+								HttpGet: &corev1.HTTPGetActionArgs{
+									Path: pulumi.String("/actuator/health/readiness"),
+									Port: pulumi.Int(8080),
+								},
+								InitialDelaySeconds: pulumi.Int(10),
+								PeriodSeconds:       pulumi.Int(5),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FailoverAppResult{
+		Namespace:      namespace.Metadata.Name().Elem(),
+		DeploymentName: deployment.Metadata.Name().Elem(),
+	}, nil
+}
+
+// CreateConnectionConfigMap writes the deployed cluster's connection settings to the
+// redis-connection ConfigMap in namespace, using the same variable names the app is
+// given. Values come from the replication group, so they track its actual settings.
+// The lab cluster has no auth token, so the secret reference is empty
+func CreateConnectionConfigMap(ctx *pulumi.Context, provider *kubernetes.Provider, namespace pulumi.StringOutput, redis *ElastiCacheResult) (*ConnectionConfigMapResult, error) {
+	configMap, err := corev1.NewConfigMap(ctx, "redis-connection", &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-connection"),
+			Namespace: namespace,
+			Labels: pulumi.StringMap{
+				"app.kubernetes.io/name":    pulumi.String("redis-connection"),
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+		},
+		Data: pulumi.StringMap{
+			"REDIS_CLUSTER_ENDPOINT":     pulumi.Sprintf("%s:%d", redis.ConfigurationEndpoint, redis.Port),
+			"REDIS_HOST":                 redis.ConfigurationEndpoint,
+			"REDIS_PORT":                 pulumi.Sprintf("%d", redis.Port),
+			"REDIS_SSL_ENABLED":          pulumi.Sprintf("%t", redis.TransitEncryptionEnabled),
+			"REDIS_CLUSTER_MODE_ENABLED": pulumi.Sprintf("%t", redis.ClusterEnabled),
+			"REDIS_AUTH_ENABLED":         pulumi.String("false"),
+			"REDIS_AUTH_SECRET_REF":      pulumi.String(""),
+			"REDIS_CLIENT_CONFIG":        redis.ClientConfig,
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnectionConfigMapResult{
+		Name: configMap.Metadata.Name().Elem(),
+	}, nil
+}
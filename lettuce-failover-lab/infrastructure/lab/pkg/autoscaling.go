@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/appautoscaling"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type CacheAutoScalingResult struct {
+	PolicyArns pulumi.StringArray
+}
+
+// cacheScalingDimension is one ElastiCache scalable dimension with its target-tracking metric
+type cacheScalingDimension struct {
+	name              string
+	scalableDimension string
+	metricType        string
+	minCapacity       int
+	maxCapacity       int
+	targetValue       float64
+}
+
+// CreateCacheAutoScaling registers a replication group's replicas and shards as scalable
+// targets with target-tracking policies on engine CPU, to observe scaling during failover
+// Resource names derive from clusterKey, matching CreateElastiCacheCluster
+func CreateCacheAutoScaling(ctx *pulumi.Context, awsProvider *aws.Provider, clusterKey string, replicationGroupId pulumi.StringOutput, cfg *LabConfig) (*CacheAutoScalingResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+	dimensions := []cacheScalingDimension{
+		{
+			name:              "replicas",
+			scalableDimension: "elasticache:replication-group:Replicas",
+			metricType:        "ElastiCacheReplicaEngineCPUUtilization",
+			minCapacity:       replicasPerShard,
+			maxCapacity:       5,
+			targetValue:       cfg.CacheAutoScalingReplicaCpuTarget,
+		},
+		{
+			name:              "shards",
+			scalableDimension: "elasticache:replication-group:NodeGroups",
+			metricType:        "ElastiCachePrimaryEngineCPUUtilization",
+			minCapacity:       numShards,
+			maxCapacity:       numShards * 2,
+			targetValue:       cfg.CacheAutoScalingShardCpuTarget,
+		},
+	}
+
+	var policyArns pulumi.StringArray
+	for _, d := range dimensions {
+		target, err := appautoscaling.NewTarget(ctx, prefix+"-scaling-"+d.name, &appautoscaling.TargetArgs{
+			ServiceNamespace:  pulumi.String("elasticache"),
+			ResourceId:        pulumi.Sprintf("replication-group/%s", replicationGroupId),
+			ScalableDimension: pulumi.String(d.scalableDimension),
+			MinCapacity:       pulumi.Int(d.minCapacity),
+			MaxCapacity:       pulumi.Int(d.maxCapacity),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+
+		policy, err := appautoscaling.NewPolicy(ctx, prefix+"-scaling-"+d.name+"-cpu", &appautoscaling.PolicyArgs{
+			PolicyType:        pulumi.String("TargetTrackingScaling"),
+			ServiceNamespace:  target.ServiceNamespace,
+			ResourceId:        target.ResourceId,
+			ScalableDimension: target.ScalableDimension,
+			TargetTrackingScalingPolicyConfiguration: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationArgs{
+				TargetValue: pulumi.Float64(d.targetValue),
+				PredefinedMetricSpecification: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
+					PredefinedMetricType: pulumi.String(d.metricType),
+				},
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		policyArns = append(policyArns, policy.Arn)
+	}
+
+	return &CacheAutoScalingResult{
+		PolicyArns: policyArns,
+	}, nil
+}
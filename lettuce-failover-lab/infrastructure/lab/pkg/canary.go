@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/synthetics"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type CanaryResult struct {
+	CanaryName pulumi.StringOutput
+	AlarmArn   pulumi.StringOutput
+}
+
+// canaryScript renders a Synthetics Node.js handler that fails unless appUrl returns 2xx
+func canaryScript(appUrl string) (string, error) {
+	quotedUrl, err := json.Marshal(appUrl)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`const synthetics = require('Synthetics');
+
+exports.handler = async () => {
+  const url = new URL(%s);
+  const requestOptions = {
+    hostname: url.hostname,
+    method: 'GET',
+    path: url.pathname + url.search,
+    port: url.port || (url.protocol === 'https:' ? 443 : 80),
+    protocol: url.protocol,
+  };
+  await synthetics.executeHttpStep('checkAppHealth', requestOptions, async (res) => {
+    if (res.statusCode < 200 || res.statusCode > 299) {
+      throw new Error(res.statusCode + ' ' + res.statusMessage);
+    }
+  });
+};
+`, quotedUrl), nil
+}
+
+// CreateCanary creates a CloudWatch Synthetics canary that checks appUrl every minute
+// from inside the EKS subnets, with its own artifact bucket, IAM role and failure alarm
+func CreateCanary(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, appUrl string, subnetIds []string, securityGroupId string) (*CanaryResult, error) {
+	script, err := canaryScript(appUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create S3 bucket for canary code and run artifacts
+	bucket, err := s3.NewBucketV2(ctx, "redis-failover-lab-canary-artifacts", &s3.BucketV2Args{
+		ForceDestroy: pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-canary-artifacts"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Key by content hash so script changes roll out a new canary version
+	codeKey := fmt.Sprintf("code/health-check-%x.zip", sha256.Sum256([]byte(script)))
+	code, err := s3.NewBucketObjectv2(ctx, "redis-failover-lab-canary-code", &s3.BucketObjectv2Args{
+		Bucket: bucket.ID(),
+		Key:    pulumi.String(codeKey),
+		Source: pulumi.NewAssetArchive(map[string]interface{}{
+			"nodejs/node_modules/index.js": pulumi.NewStringAsset(script),
+		}),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create IAM role for the canary Lambda
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	canaryRole, err := iam.NewRole(ctx, "redis-failover-lab-canary-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-canary-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Running inside the VPC needs ENI management
+	_, err = iam.NewRolePolicyAttachment(ctx, "canary-vpc-access-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      canaryRole.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaVPCAccessExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	canaryPolicy := bucket.Arn.ApplyT(func(bucketArn string) (string, error) {
+		policy, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"s3:PutObject", "s3:GetObject", "s3:GetBucketLocation"},
+					"Resource": []string{bucketArn, bucketArn + "/*"},
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"s3:ListAllMyBuckets", "xray:PutTraceSegments"},
+					"Resource": "*",
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   "cloudwatch:PutMetricData",
+					"Resource": "*",
+					"Condition": map[string]interface{}{
+						"StringEquals": map[string]string{"cloudwatch:namespace": "CloudWatchSynthetics"},
+					},
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"logs:CreateLogGroup", "logs:CreateLogStream", "logs:PutLogEvents"},
+					"Resource": "*",
+				},
+			},
+		})
+		return string(policy), err
+	}).(pulumi.StringOutput)
+
+	_, err = iam.NewRolePolicy(ctx, "redis-failover-lab-canary-policy", &iam.RolePolicyArgs{
+		Role:   canaryRole.Name,
+		Policy: canaryPolicy,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the canary; names are limited to 21 lowercase characters
+	canary, err := synthetics.NewCanary(ctx, "redis-failover-lab-canary", &synthetics.CanaryArgs{
+		Name:               pulumi.String("redis-failover-lab"),
+		ArtifactS3Location: pulumi.Sprintf("s3://%s/artifacts/", bucket.Bucket),
+		ExecutionRoleArn:   canaryRole.Arn,
+		RuntimeVersion:     pulumi.String("syn-nodejs-puppeteer-9.1"),
+		Handler:            pulumi.String("index.handler"),
+		S3Bucket:           bucket.Bucket,
+		S3Key:              code.Key,
+		StartCanary:        pulumi.Bool(true),
+		DeleteLambda:       pulumi.Bool(true),
+		Schedule: &synthetics.CanaryScheduleArgs{
+			Expression: pulumi.String("rate(1 minute)"),
+		},
+		RunConfig: &synthetics.CanaryRunConfigArgs{
+			TimeoutInSeconds: pulumi.Int(30),
+		},
+		VpcConfig: &synthetics.CanaryVpcConfigArgs{
+			SubnetIds:        pulumi.ToStringArray(subnetIds),
+			SecurityGroupIds: pulumi.StringArray{pulumi.String(securityGroupId)},
+		},
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-canary"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Alarm when health checks fail; notifications go through the lab health composite alarm
+	alarmName := cfg.alarmName("canary-failed", 0)
+	alarm, err := cloudwatch.NewMetricAlarm(ctx, "redis-failover-lab-canary-failed", &cloudwatch.MetricAlarmArgs{
+		Name:             pulumi.String(alarmName),
+		AlarmDescription: pulumi.String("Synthetics canary cannot reach the failover app health endpoint"),
+		Namespace:        pulumi.String("CloudWatchSynthetics"),
+		MetricName:       pulumi.String("SuccessPercent"),
+		Dimensions: pulumi.StringMap{
+			"CanaryName": canary.Name,
+		},
+		Statistic:          pulumi.String("Average"),
+		Period:             pulumi.Int(300),
+		EvaluationPeriods:  pulumi.Int(1),
+		Threshold:          pulumi.Float64(90),
+		ComparisonOperator: pulumi.String("LessThanThreshold"),
+		TreatMissingData:   pulumi.String("breaching"),
+		Tags:               alarmTags(ctx, alarmName),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CanaryResult{
+		CanaryName: canary.Name,
+		AlarmArn:   alarm.Arn,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/elasticache"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	helmv3 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// chaosMeshNamespace holds the Chaos Mesh controller and daemons
+const chaosMeshNamespace = "chaos-mesh"
+
+type ChaosExperimentResult struct {
+	ExperimentName pulumi.StringOutput
+}
+
+// lookupNodeAddresses returns the configuration endpoint and the address of every
+// node, so a partition cuts the app off the whole cluster rather than one node
+func lookupNodeAddresses(ctx *pulumi.Context, awsProvider *aws.Provider, redis *ElastiCacheResult) pulumi.StringArray {
+	addresses := pulumi.StringArray{redis.ConfigurationEndpoint}
+	for _, suffix := range nodeSuffixes(redis.ShardReplicas) {
+		node := elasticache.LookupClusterOutput(ctx, elasticache.LookupClusterOutputArgs{
+			ClusterId: pulumi.Sprintf("%s-%s", redis.ReplicationGroupId, suffix),
+		}, pulumi.Provider(awsProvider))
+		addresses = append(addresses, node.CacheNodes().Index(pulumi.Int(0)).Address())
+	}
+	return addresses
+}
+
+// DeployChaosExperiment installs Chaos Mesh and a NetworkChaos partition between the
+// app pods in namespace and the Redis nodes, lasting partitionDuration. It is created
+// paused so nothing is injected on deploy; removing the pause annotation starts it:
+//
+//	kubectl annotate networkchaos redis-partition -n <namespace> experiment.chaos-mesh.org/pause-
+func DeployChaosExperiment(ctx *pulumi.Context, awsProvider *aws.Provider, provider *kubernetes.Provider, namespace pulumi.StringOutput, redis *ElastiCacheResult, partitionDuration string) (*ChaosExperimentResult, error) {
+	// Bottlerocket runs containerd; the daemons need its socket to enter pod netns
+	release, err := helmv3.NewRelease(ctx, "chaos-mesh", &helmv3.ReleaseArgs{
+		Name:            pulumi.String("chaos-mesh"),
+		Chart:           pulumi.String("chaos-mesh"),
+		Version:         pulumi.String("2.7.0"),
+		Namespace:       pulumi.String(chaosMeshNamespace),
+		CreateNamespace: pulumi.Bool(true),
+		RepositoryOpts: &helmv3.RepositoryOptsArgs{
+			Repo: pulumi.String("https://charts.chaos-mesh.org"),
+		},
+		Values: pulumi.Map{
+			"chaosDaemon": pulumi.Map{
+				"runtime":    pulumi.String("containerd"),
+				"socketPath": pulumi.String("/run/containerd/containerd.sock"),
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	experiment, err := apiextensions.NewCustomResource(ctx, "redis-partition", &apiextensions.CustomResourceArgs{
+		ApiVersion: pulumi.String("chaos-mesh.org/v1alpha1"),
+		Kind:       pulumi.String("NetworkChaos"),
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-partition"),
+			Namespace: namespace,
+			Labels: pulumi.StringMap{
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+			Annotations: pulumi.StringMap{
+				"experiment.chaos-mesh.org/pause": pulumi.String("true"),
+			},
+		},
+		OtherFields: kubernetes.UntypedArgs{
+			"spec": pulumi.Map{
+				"action":   pulumi.String("partition"),
+				"mode":     pulumi.String("all"),
+				"duration": pulumi.String(partitionDuration),
+				"selector": pulumi.Map{
+					"namespaces": pulumi.StringArray{namespace},
+					"labelSelectors": pulumi.StringMap{
+						"app.kubernetes.io/name": pulumi.String("redis-failover-app"),
+					},
+				},
+				"direction":       pulumi.String("to"),
+				"externalTargets": lookupNodeAddresses(ctx, awsProvider, redis),
+			},
+		},
+	}, pulumi.Provider(provider), pulumi.DependsOn([]pulumi.Resource{release}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChaosExperimentResult{
+		ExperimentName: pulumi.Sprintf("%s/%s", namespace, experiment.Metadata.Name().Elem()),
+	}, nil
+}
@@ -0,0 +1,782 @@
+package pkg
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// configSchema documents every lab config key and is validated before any resource is created
+//
+//go:embed config.schema.json
+var configSchema string
+
+// LabConfig is the resolved lab stack configuration
+type LabConfig struct {
+	VpcId                            string               `json:"vpcId"`
+	Region                           string               `json:"region"`
+	AllowRegionMismatch              bool                 `json:"allowRegionMismatch"`
+	ProviderVersion                  map[string]string    `json:"providerVersion"`
+	RunId                            string               `json:"runId"`
+	EksSecurityGroupId               string               `json:"eksSecurityGroupId"`
+	RedisSecurityGroupId             string               `json:"redisSecurityGroupId"`
+	ExtraRedisSecurityGroupIds       []string             `json:"extraRedisSecurityGroupIds"`
+	PrivateSubnetIds                 []string             `json:"privateSubnetIds"`
+	EksSubnetIds                     []string             `json:"eksSubnetIds"`
+	RedisSubnetIds                   []string             `json:"redisSubnetIds"`
+	NodeType                         string               `json:"nodeType"`
+	EksAzCount                       int                  `json:"eksAzCount"`
+	EksClusterName                   string               `json:"eksClusterName"`
+	NodeGroupType                    string               `json:"nodeGroupType"`
+	WaitForEksNodes                  bool                 `json:"waitForEksNodes"`
+	EksReadyTimeout                  int                  `json:"eksReadyTimeout"`
+	HealthGate                       bool                 `json:"healthGate"`
+	HealthGateTimeout                int                  `json:"healthGateTimeout"`
+	HealthGateChecks                 []string             `json:"healthGateChecks"`
+	HealthGateMaxReplicationLag      float64              `json:"healthGateMaxReplicationLag"`
+	FailoverAnnotations              []FailoverAnnotation `json:"failoverAnnotations"`
+	ObserverPrincipalArn             string               `json:"observerPrincipalArn"`
+	ApplyImmediately                 *bool                `json:"applyImmediately"`
+	DeferMaintenance                 bool                 `json:"deferMaintenance"`
+	EksMonitoring                    bool                 `json:"eksMonitoring"`
+	IncludeEksWidgets                bool                 `json:"includeEksWidgets"`
+	Adot                             bool                 `json:"adot"`
+	AppMetricsRole                   bool                 `json:"appMetricsRole"`
+	AccessEntries                    []AccessEntry        `json:"accessEntries"`
+	CiRoleArn                        string               `json:"ciRoleArn"`
+	CreateCanary                     bool                 `json:"createCanary"`
+	CanaryUrl                        string               `json:"canaryUrl"`
+	MetricStream                     bool                 `json:"metricStream"`
+	MetricStreamBucket               string               `json:"metricStreamBucket"`
+	Clusters                         []ClusterConfig      `json:"clusters"`
+	BackupPlanTag                    *BackupPlanTag       `json:"backupPlanTag"`
+	FailedOpsAlarmWindowSeconds      int                  `json:"failedOpsAlarmWindowSeconds"`
+	FailedOpsAlarmThreshold          float64              `json:"failedOpsAlarmThreshold"`
+	ElasticacheAzs                   []string             `json:"elasticacheAzs"`
+	LocalZone                        string               `json:"localZone"`
+	EmitGrafanaDashboard             bool                 `json:"emitGrafanaDashboard"`
+	EmitImportList                   bool                 `json:"emitImportList"`
+	EngineVersion                    string               `json:"engineVersion"`
+	Encryption                       *bool                `json:"encryption"`
+	SkipFinalSnapshot                *bool                `json:"skipFinalSnapshot"`
+	FinalSnapshotIdentifier          string               `json:"finalSnapshotIdentifier"`
+	EksPublicAccessCidrs             []string             `json:"eksPublicAccessCidrs"`
+	AllowOpenApiAccess               bool                 `json:"allowOpenApiAccess"`
+	GrafanaWorkspaceRegion           string               `json:"grafanaWorkspaceRegion"`
+	ExportPrometheusScrapeConfig     bool                 `json:"exportPrometheusScrapeConfig"`
+	BottlerocketSettingsToml         string               `json:"bottlerocketSettingsToml"`
+	DeployRedisExporter              bool                 `json:"deployRedisExporter"`
+	CacheAutoScaling                 bool                 `json:"cacheAutoScaling"`
+	CacheAutoScalingReplicaCpuTarget float64              `json:"cacheAutoScalingReplicaCpuTarget"`
+	CacheAutoScalingShardCpuTarget   float64              `json:"cacheAutoScalingShardCpuTarget"`
+	ShardReplicas                    []int                `json:"shardReplicas"`
+	ReplicaOverrides                 map[string]int       `json:"replicaOverrides"`
+	NodeReplacementShard             int                  `json:"nodeReplacementShard"`
+	NodeReplacementRunId             string               `json:"nodeReplacementRunId"`
+	TriggerFailoverOnDeploy          bool                 `json:"triggerFailoverOnDeploy"`
+	FailoverShardIndex               int                  `json:"failoverShardIndex"`
+	NetworkType                      string               `json:"networkType"`
+	IpDiscovery                      string               `json:"ipDiscovery"`
+	TeardownWebhookUrl               string               `json:"teardownWebhookUrl"`
+	DeployApp                        bool                 `json:"deployApp"`
+	AppReplicas                      int                  `json:"appReplicas"`
+	AppImage                         string               `json:"appImage"`
+	AppInitImage                     string               `json:"appInitImage"`
+	RedisWaitTimeoutSeconds          int                  `json:"redisWaitTimeoutSeconds"`
+	AppEnv                           map[string]string    `json:"appEnv"`
+	AppArgs                          []string             `json:"appArgs"`
+	CreateConnectionConfigMap        bool                 `json:"createConnectionConfigMap"`
+	ExportLettuceConfig              bool                 `json:"exportLettuceConfig"`
+	LettuceRefreshPeriod             string               `json:"lettuceRefreshPeriod"`
+	DeployChaosExperiment            bool                 `json:"deployChaosExperiment"`
+	ChaosPartitionDuration           string               `json:"chaosPartitionDuration"`
+	DeployPrometheusStack            bool                 `json:"deployPrometheusStack"`
+	TlsPolicyNote                    string               `json:"tlsPolicyNote"`
+	PriceOverrides                   map[string]float64   `json:"priceOverrides"`
+	ReservedNodeOverrides            reservableNodes      `json:"reservedNodeOverrides"`
+	CreateElasticacheSubnets         bool                 `json:"createElasticacheSubnets"`
+	ElasticacheSubnetCidrs           []string             `json:"elasticacheSubnetCidrs"`
+	DashboardShardFilter             bool                 `json:"dashboardShardFilter"`
+	DeployFailoverObserver           bool                 `json:"deployFailoverObserver"`
+	SeedData                         bool                 `json:"seedData"`
+	SeedKeyCount                     int                  `json:"seedKeyCount"`
+	ClusterNodeTimeout               int                  `json:"clusterNodeTimeout"`
+	ConnectionLogging                bool                 `json:"connectionLogging"`
+	SeparateRedisLogGroups           bool                 `json:"separateRedisLogGroups"`
+	ParameterOverrides               map[string]string    `json:"parameterOverrides"`
+	CreateInitialSnapshot            bool                 `json:"createInitialSnapshot"`
+	InitialSnapshotName              string               `json:"initialSnapshotName"`
+	RetainLogsOnDestroy              bool                 `json:"retainLogsOnDestroy"`
+	LogRetentionDays                 int                  `json:"logRetentionDays"`
+	BackupBeforeDestroy              bool                 `json:"backupBeforeDestroy"`
+	DashboardGrouping                string               `json:"dashboardGrouping"`
+	LatencyStatistics                []string             `json:"latencyStatistics"`
+	LatencyPeriod                    int                  `json:"latencyPeriod"`
+	HighResMetrics                   bool                 `json:"highResMetrics"`
+	DashboardStart                   string               `json:"dashboardStart"`
+	DashboardPeriodOverride          string               `json:"dashboardPeriodOverride"`
+	DashboardStacked                 map[string]bool      `json:"dashboardStacked"`
+	ScopeElasticachePolicy           bool                 `json:"scopeElasticachePolicy"`
+	ExistingSubnetGroupName          string               `json:"existingSubnetGroupName"`
+	ExistingParameterGroupName       string               `json:"existingParameterGroupName"`
+	AlarmNamePrefix                  string               `json:"alarmNamePrefix"`
+	ShardAlarms                      bool                 `json:"shardAlarms"`
+	MonitoringSourceStackRef         string               `json:"monitoringSourceStackRef"`
+	FailoverReportSchedule           string               `json:"failoverReportSchedule"`
+	FailoverReportWindowHours        int                  `json:"failoverReportWindowHours"`
+
+	// secretKeys are the keys set as Pulumi secrets, redacted from ResolvedConfig
+	secretKeys map[string]bool
+}
+
+// redactedConfigKeys are redacted from ResolvedConfig even when not set as secrets
+// Webhook URLs carry their token in the path
+var redactedConfigKeys = []string{"teardownWebhookUrl"}
+
+// schemaProperties is the subset of the schema needed to read raw config values
+type schemaProperties struct {
+	Properties map[string]struct {
+		Type string `json:"type"`
+		Ref  string `json:"$ref"`
+	} `json:"properties"`
+}
+
+// LoadConfig reads every key documented in the schema, validates the whole
+// config at once, and returns the resolved LabConfig with defaults applied
+func LoadConfig(ctx *pulumi.Context) (*LabConfig, error) {
+	cfg := config.New(ctx, "")
+
+	var schema schemaProperties
+	if err := json.Unmarshal([]byte(configSchema), &schema); err != nil {
+		return nil, fmt.Errorf("invalid embedded config schema: %w", err)
+	}
+
+	// Pulumi stores every config value as a string, so decode each one by its
+	// schema type; values that fail to decode are kept raw for the schema to report
+	doc := map[string]interface{}{}
+	secretKeys := map[string]bool{}
+	for key, prop := range schema.Properties {
+		raw := cfg.Get(key)
+		if raw == "" {
+			continue
+		}
+		doc[key] = decodeConfigValue(raw, prop.Type, prop.Ref)
+		if ctx.IsConfigSecret(ctx.Project() + ":" + key) {
+			secretKeys[key] = true
+		}
+		if prop.Ref == "#/definitions/subnetIds" {
+			doc[key] = normalizeSubnetIds(doc[key])
+		}
+	}
+
+	if err := ValidateConfig(doc); err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var labConfig LabConfig
+	if err := json.Unmarshal(bytes, &labConfig); err != nil {
+		return nil, err
+	}
+	labConfig.secretKeys = secretKeys
+	labConfig.applyDefaults()
+	if err := labConfig.resolveRegion(ambientRegion(ctx)); err != nil {
+		return nil, err
+	}
+	if labConfig.RunId == "" {
+		runId, err := previousRunId(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if runId == "" {
+			if runId, err = newRunId(); err != nil {
+				return nil, err
+			}
+		}
+		labConfig.RunId = runId
+	}
+	return &labConfig, nil
+}
+
+// previousRunId returns the runId the stack exported on its last update, empty
+// before its first one, so a generated runId is kept until the stack is destroyed
+// rather than retagging every resource on each update
+func previousRunId(ctx *pulumi.Context) (string, error) {
+	self, err := pulumi.NewStackReference(ctx, "redis-failover-lab-previous-run", &pulumi.StackReferenceArgs{
+		Name: pulumi.String(fmt.Sprintf("%s/%s/%s", ctx.Organization(), ctx.Project(), ctx.Stack())),
+	})
+	if err != nil {
+		return "", err
+	}
+	details, err := self.GetOutputDetails("runId")
+	if err != nil {
+		return "", fmt.Errorf("reading the previous runId: %w", err)
+	}
+	runId, _ := details.Value.(string)
+	return runId, nil
+}
+
+// newRunId generates a random (version 4) UUID, so every stack without a configured
+// runId is told apart from the others
+func newRunId() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating runId: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// ResolvedConfig returns every LabConfig value after defaults, keyed like the stack
+// config, to diff what two labs deployed. Unset lists, maps and pointers are left
+// out, and secrets are replaced by [secret]
+func (c *LabConfig) ResolvedConfig() (map[string]interface{}, error) {
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var resolved map[string]interface{}
+	if err := json.Unmarshal(bytes, &resolved); err != nil {
+		return nil, err
+	}
+	for key, value := range resolved {
+		if value == nil {
+			delete(resolved, key)
+		}
+	}
+	for key := range c.secretKeys {
+		resolved[key] = "[secret]"
+	}
+	for _, key := range redactedConfigKeys {
+		if value, ok := resolved[key]; ok && value != "" {
+			resolved[key] = "[secret]"
+		}
+	}
+	return resolved, nil
+}
+
+// normalizeSubnetIds trims whitespace from each subnet ID and drops repeats, keeping
+// the first occurrence, so " subnet-a" and a pasted duplicate behave like the clean
+// list. Anything but a list of strings is returned unchanged for the schema to report
+func normalizeSubnetIds(value interface{}) interface{} {
+	ids, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	seen := map[string]bool{}
+	normalized := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		s, ok := id.(string)
+		if !ok {
+			normalized = append(normalized, id)
+			continue
+		}
+		s = strings.TrimSpace(s)
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		normalized = append(normalized, s)
+	}
+	return normalized
+}
+
+// decodeConfigValue converts a raw config string into the JSON type the schema expects
+func decodeConfigValue(raw, schemaType, ref string) interface{} {
+	switch {
+	case schemaType == "integer" || schemaType == "number":
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n
+		}
+	case schemaType == "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	case schemaType == "array" || schemaType == "object" || ref != "":
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err == nil {
+			return v
+		}
+	}
+	return raw
+}
+
+// ValidateConfig checks a config document against the embedded JSON schema,
+// reporting every problem found rather than stopping at the first
+func ValidateConfig(doc map[string]interface{}) error {
+	schema, err := jsonschema.CompileString("config.schema.json", configSchema)
+	if err != nil {
+		return fmt.Errorf("invalid embedded config schema: %w", err)
+	}
+
+	var problems []string
+	if err := schema.Validate(doc); err != nil {
+		validationErr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return err
+		}
+		collectValidationErrors(validationErr, &problems)
+	}
+	problems = append(problems, configConflicts(doc)...)
+	problems = append(problems, publicAccessCidrProblems(doc)...)
+	problems = append(problems, bottlerocketSettingsProblems(doc)...)
+	problems = append(problems, elasticacheSubnetCidrProblems(doc)...)
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("invalid configuration (%d problems):\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+}
+
+// collectValidationErrors flattens nested schema errors into one message per leaf
+func collectValidationErrors(ve *jsonschema.ValidationError, problems *[]string) {
+	if len(ve.Causes) == 0 {
+		location := ve.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: %s", location, ve.Message))
+		return
+	}
+	for _, cause := range ve.Causes {
+		collectValidationErrors(cause, problems)
+	}
+}
+
+// configConflicts reports combinations of keys that are individually valid but
+// cannot be used together, which JSON schema cannot express readably
+func configConflicts(doc map[string]interface{}) []string {
+	var problems []string
+	if doc["deferMaintenance"] == true && doc["applyImmediately"] == true {
+		problems = append(problems, "/deferMaintenance: cannot be combined with applyImmediately: true")
+	}
+	if replicas, ok := doc["appReplicas"].(float64); ok && replicas > eksDesiredNodeCount {
+		problems = append(problems, fmt.Sprintf("/appReplicas: %v exceeds the %d EKS nodes; app pods require distinct nodes", replicas, eksDesiredNodeCount))
+	}
+	networkType, _ := doc["networkType"].(string)
+	if doc["ipDiscovery"] == "ipv6" && (networkType == "" || networkType == "ipv4") {
+		problems = append(problems, "/ipDiscovery: ipv6 requires networkType ipv6 or dual_stack")
+	}
+	if doc["ipDiscovery"] == "ipv4" && networkType == "ipv6" {
+		problems = append(problems, "/ipDiscovery: ipv4 cannot be used with networkType ipv6")
+	}
+	if engineVersion, _ := doc["engineVersion"].(string); preSixEngine(engineVersion) {
+		if doc["encryption"] != false {
+			problems = append(problems, fmt.Sprintf("/engineVersion: %s predates 6.0 and its in-transit encryption does not support every cluster mode setup the lab uses; set encryption: false to run it unencrypted", engineVersion))
+		}
+		if doc["connectionLogging"] == true {
+			problems = append(problems, fmt.Sprintf("/connectionLogging: the engine log requires engineVersion 6.2 or later, not %s", engineVersion))
+		}
+		if doc["separateRedisLogGroups"] == true {
+			problems = append(problems, fmt.Sprintf("/separateRedisLogGroups: slow log delivery requires engineVersion 6.0 or later, not %s", engineVersion))
+		}
+	}
+	if _, ok := doc["finalSnapshotIdentifier"]; ok && doc["skipFinalSnapshot"] != false {
+		problems = append(problems, "/finalSnapshotIdentifier: only used when skipFinalSnapshot is explicitly false")
+	}
+	if _, ok := doc["region"]; !ok && doc["allowRegionMismatch"] == true {
+		problems = append(problems, "/allowRegionMismatch: only used with region")
+	}
+	if _, ok := doc["eksReadyTimeout"]; ok && doc["waitForEksNodes"] != true {
+		problems = append(problems, "/eksReadyTimeout: only used with waitForEksNodes: true")
+	}
+	if _, ok := doc["metricStreamBucket"]; ok && doc["metricStream"] != true {
+		problems = append(problems, "/metricStreamBucket: only used with metricStream: true")
+	}
+	for _, key := range []string{"healthGateTimeout", "healthGateChecks", "healthGateMaxReplicationLag"} {
+		if _, ok := doc[key]; ok && doc["healthGate"] != true {
+			problems = append(problems, "/"+key+": only used with healthGate: true")
+		}
+	}
+	if _, ok := doc["healthGateMaxReplicationLag"]; ok {
+		if checks, ok := doc["healthGateChecks"].([]interface{}); ok {
+			lagChecked := false
+			for _, check := range checks {
+				lagChecked = lagChecked || check == "replicationLag"
+			}
+			if !lagChecked {
+				problems = append(problems, "/healthGateMaxReplicationLag: only used with the replicationLag check")
+			}
+		}
+	}
+	if replicas, ok := doc["shardReplicas"].([]interface{}); ok {
+		if len(replicas) != numShards {
+			problems = append(problems, fmt.Sprintf("/shardReplicas: %d entries for %d shards", len(replicas), numShards))
+		}
+		if doc["cacheAutoScaling"] == true {
+			problems = append(problems, "/shardReplicas: cannot be combined with cacheAutoScaling: true")
+		}
+	}
+	if shard, ok := doc["nodeReplacementShard"].(float64); ok && int(shard) > numShards {
+		problems = append(problems, fmt.Sprintf("/nodeReplacementShard: shard out of range, the cluster has %d shards", numShards))
+	}
+	if shard, ok := doc["failoverShardIndex"].(float64); ok {
+		if int(shard) > numShards {
+			problems = append(problems, fmt.Sprintf("/failoverShardIndex: shard out of range, the cluster has %d shards", numShards))
+		}
+		if doc["triggerFailoverOnDeploy"] != true {
+			problems = append(problems, "/failoverShardIndex: only used with triggerFailoverOnDeploy: true")
+		}
+	}
+	// Both disrupt a shard on the same pulumi up, and TestFailover is refused while
+	// another failover is under way
+	if _, ok := doc["nodeReplacementShard"]; ok && doc["triggerFailoverOnDeploy"] == true {
+		problems = append(problems, "/triggerFailoverOnDeploy: cannot be combined with nodeReplacementShard")
+	}
+	// Auto scaling owns the replica counts the replacement changes
+	if _, ok := doc["nodeReplacementShard"]; ok && doc["cacheAutoScaling"] == true {
+		problems = append(problems, "/nodeReplacementShard: cannot be combined with cacheAutoScaling: true")
+	}
+	if _, ok := doc["nodeReplacementRunId"]; ok {
+		if _, ok := doc["nodeReplacementShard"]; !ok {
+			problems = append(problems, "/nodeReplacementRunId: only used with nodeReplacementShard")
+		}
+	}
+	if overrides, ok := doc["replicaOverrides"].(map[string]interface{}); ok {
+		for shard := range overrides {
+			if index, err := strconv.Atoi(shard); err != nil || index < 1 || index > numShards {
+				problems = append(problems, fmt.Sprintf("/replicaOverrides/%s: shard out of range, the cluster has %d shards", shard, numShards))
+			}
+		}
+		if _, ok := doc["shardReplicas"]; ok {
+			problems = append(problems, "/replicaOverrides: cannot be combined with shardReplicas")
+		}
+		if doc["cacheAutoScaling"] == true {
+			problems = append(problems, "/replicaOverrides: cannot be combined with cacheAutoScaling: true")
+		}
+	}
+	if _, ok := doc["failoverReportWindowHours"]; ok {
+		if _, ok := doc["failoverReportSchedule"]; !ok {
+			problems = append(problems, "/failoverReportWindowHours: only used with failoverReportSchedule")
+		}
+	}
+	if _, ok := doc["latencyPeriod"]; ok {
+		if _, ok := doc["latencyStatistics"]; !ok {
+			problems = append(problems, "/latencyPeriod: only used with latencyStatistics")
+		}
+	}
+	if _, ok := doc["initialSnapshotName"]; ok && doc["createInitialSnapshot"] != true {
+		problems = append(problems, "/initialSnapshotName: only used when createInitialSnapshot is true")
+	}
+	if doc["includeEksWidgets"] == true && doc["eksMonitoring"] != true {
+		problems = append(problems, "/includeEksWidgets: requires eksMonitoring: true, which enables Container Insights")
+	}
+	if _, ok := doc["seedKeyCount"]; ok && doc["seedData"] != true {
+		problems = append(problems, "/seedKeyCount: only used with seedData: true")
+	}
+	if doc["deployPrometheusStack"] == true && doc["deployRedisExporter"] != true {
+		problems = append(problems, "/deployPrometheusStack: requires deployRedisExporter: true for its scrape target")
+	}
+	if tag, ok := doc["backupPlanTag"].(map[string]interface{}); ok {
+		key, _ := tag["key"].(string)
+		switch {
+		case strings.HasPrefix(key, "aws:"):
+			problems = append(problems, "/backupPlanTag/key: the aws: prefix is reserved by AWS")
+		case key == "Name" || key == "Environment" || key == "Purpose":
+			problems = append(problems, fmt.Sprintf("/backupPlanTag/key: %s is set by the stack", key))
+		}
+	}
+	if overrides, ok := doc["parameterOverrides"].(map[string]interface{}); ok {
+		// Parameters the stack sets itself, with the key that sets them if optional
+		for _, owned := range [][2]string{
+			{"cluster-enabled", ""},
+			{"cluster-node-timeout", "clusterNodeTimeout"},
+			{"notify-keyspace-events", "deployFailoverObserver"},
+		} {
+			name, key := owned[0], owned[1]
+			if _, ok := overrides[name]; !ok {
+				continue
+			}
+			if key == "" {
+				problems = append(problems, fmt.Sprintf("/parameterOverrides/%s: set by the stack for cluster mode", name))
+			} else if _, ok := doc[key]; ok {
+				problems = append(problems, fmt.Sprintf("/parameterOverrides/%s: cannot be combined with %s", name, key))
+			}
+		}
+	}
+	if doc["deployChaosExperiment"] == true && doc["deployApp"] != true {
+		problems = append(problems, "/deployChaosExperiment: requires deployApp: true for the app pods it partitions")
+	}
+	if extra, ok := doc["extraRedisSecurityGroupIds"].([]interface{}); ok {
+		for i, id := range extra {
+			if id == doc["redisSecurityGroupId"] {
+				problems = append(problems, fmt.Sprintf("/extraRedisSecurityGroupIds/%d: is redisSecurityGroupId, which is always attached", i))
+			}
+		}
+	}
+	if _, ok := doc["lettuceRefreshPeriod"]; ok && doc["exportLettuceConfig"] != true {
+		problems = append(problems, "/lettuceRefreshPeriod: only used with exportLettuceConfig: true")
+	}
+	if _, ok := doc["chaosPartitionDuration"]; ok && doc["deployChaosExperiment"] != true {
+		problems = append(problems, "/chaosPartitionDuration: only used when deployChaosExperiment is true")
+	}
+	if doc["createConnectionConfigMap"] == true && doc["deployApp"] != true {
+		problems = append(problems, "/createConnectionConfigMap: requires deployApp: true for the app namespace")
+	}
+	if env, ok := doc["appEnv"].(map[string]interface{}); ok {
+		for name := range env {
+			if appConnectionEnv[name] {
+				problems = append(problems, fmt.Sprintf("/appEnv/%s: reserved; the Redis connection variables and LAB_RUN_ID are injected by the stack", name))
+			}
+		}
+	}
+	if _, ok := doc["existingSubnetGroupName"]; ok {
+		if _, ok := doc["redisSubnetIds"]; ok {
+			problems = append(problems, "/redisSubnetIds: cannot be combined with existingSubnetGroupName")
+		}
+		if doc["createElasticacheSubnets"] == true {
+			problems = append(problems, "/existingSubnetGroupName: cannot be combined with createElasticacheSubnets")
+		}
+	}
+	if _, ok := doc["localZone"]; ok {
+		for _, key := range []string{"elasticacheAzs", "existingSubnetGroupName"} {
+			if _, ok := doc[key]; ok {
+				problems = append(problems, "/"+key+": cannot be combined with localZone")
+			}
+		}
+		if doc["createElasticacheSubnets"] == true {
+			problems = append(problems, "/localZone: cannot be combined with createElasticacheSubnets")
+		}
+	}
+	if ciRoleArn, ok := doc["ciRoleArn"].(string); ok {
+		if entries, ok := doc["accessEntries"].([]interface{}); ok {
+			for i, entry := range entries {
+				if entry, ok := entry.(map[string]interface{}); ok && entry["principalArn"] == ciRoleArn {
+					problems = append(problems, fmt.Sprintf("/accessEntries/%d/principalArn: is ciRoleArn, which gets its own access entry", i))
+				}
+			}
+		}
+	}
+	if _, ok := doc["existingParameterGroupName"]; ok {
+		for _, key := range []string{"parameterOverrides", "clusterNodeTimeout"} {
+			if _, ok := doc[key]; ok {
+				problems = append(problems, "/"+key+": cannot be combined with existingParameterGroupName")
+			}
+		}
+	}
+	if doc["createElasticacheSubnets"] == true {
+		if _, ok := doc["redisSubnetIds"]; ok {
+			problems = append(problems, "/redisSubnetIds: cannot be combined with createElasticacheSubnets")
+		}
+		if networkType != "" && networkType != "ipv4" {
+			problems = append(problems, "/createElasticacheSubnets: dedicated subnets are IPv4-only; networkType must be ipv4")
+		}
+	} else if _, ok := doc["elasticacheSubnetCidrs"]; ok {
+		problems = append(problems, "/elasticacheSubnetCidrs: only used when createElasticacheSubnets is true")
+	}
+	if doc["dashboardShardFilter"] == true && doc["dashboardGrouping"] == "by-az" {
+		problems = append(problems, "/dashboardShardFilter: cannot be combined with dashboardGrouping: by-az")
+	}
+	if clusters, ok := doc["clusters"].([]interface{}); ok {
+		seen := map[string]bool{}
+		for i, cluster := range clusters {
+			entry, _ := cluster.(map[string]interface{})
+			key, _ := entry["key"].(string)
+			if key != "" && seen[key] {
+				problems = append(problems, fmt.Sprintf("/clusters/%d/key: duplicate cluster key %q", i, key))
+			}
+			seen[key] = true
+		}
+	}
+	return problems
+}
+
+// publicAccessCidrProblems rejects malformed EKS public-access CIDRs and, unless
+// allowOpenApiAccess is set, any range that opens the API to the whole internet
+func publicAccessCidrProblems(doc map[string]interface{}) []string {
+	cidrs, ok := doc["eksPublicAccessCidrs"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var problems []string
+	for i, entry := range cidrs {
+		cidr, ok := entry.(string)
+		if !ok {
+			continue // type errors are reported by the schema
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("/eksPublicAccessCidrs/%d: %q is not a valid CIDR", i, cidr))
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones == 0 && doc["allowOpenApiAccess"] != true {
+			problems = append(problems, fmt.Sprintf("/eksPublicAccessCidrs/%d: %q exposes the EKS API to the internet; set allowOpenApiAccess to allow it", i, cidr))
+		}
+	}
+	return problems
+}
+
+// elasticacheSubnetCidrProblems rejects malformed or mutually overlapping dedicated
+// subnet CIDRs; containment in the VPC is checked against AWS at deploy time
+func elasticacheSubnetCidrProblems(doc map[string]interface{}) []string {
+	cidrs, ok := doc["elasticacheSubnetCidrs"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var problems []string
+	var networks []*net.IPNet
+	for i, entry := range cidrs {
+		cidr, ok := entry.(string)
+		if !ok {
+			continue // type errors are reported by the schema
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil || network.IP.To4() == nil {
+			problems = append(problems, fmt.Sprintf("/elasticacheSubnetCidrs/%d: %q is not a valid IPv4 CIDR", i, cidr))
+			continue
+		}
+		for _, other := range networks {
+			if network.Contains(other.IP) || other.Contains(network.IP) {
+				problems = append(problems, fmt.Sprintf("/elasticacheSubnetCidrs/%d: %q overlaps %s", i, cidr, other))
+			}
+		}
+		networks = append(networks, network)
+	}
+	return problems
+}
+
+// bottlerocketSettingsProblems reports bottlerocketSettingsToml that does not parse,
+// since a bad user data document would only surface as nodes failing to join
+func bottlerocketSettingsProblems(doc map[string]interface{}) []string {
+	settings, ok := doc["bottlerocketSettingsToml"].(string)
+	if !ok {
+		return nil
+	}
+	var parsed map[string]interface{}
+	if _, err := toml.Decode(settings, &parsed); err != nil {
+		return []string{fmt.Sprintf("/bottlerocketSettingsToml: invalid TOML: %v", err)}
+	}
+	return nil
+}
+
+// applyDefaults fills in optional values left unset
+func (c *LabConfig) applyDefaults() {
+	if len(c.EksSubnetIds) == 0 {
+		c.EksSubnetIds = c.PrivateSubnetIds
+	}
+	if len(c.RedisSubnetIds) == 0 {
+		c.RedisSubnetIds = c.PrivateSubnetIds
+	}
+	if c.NodeType == "" {
+		c.NodeType = "cache.r7g.large"
+	}
+	if len(c.Clusters) == 0 {
+		c.Clusters = []ClusterConfig{{Key: defaultClusterKey}}
+	}
+	for i := range c.Clusters {
+		if c.Clusters[i].NodeType == "" {
+			c.Clusters[i].NodeType = c.NodeType
+		}
+	}
+	if c.EngineVersion == "" {
+		c.EngineVersion = "7.1"
+	}
+	if c.CacheAutoScalingReplicaCpuTarget == 0 {
+		c.CacheAutoScalingReplicaCpuTarget = 60
+	}
+	if c.CacheAutoScalingShardCpuTarget == 0 {
+		c.CacheAutoScalingShardCpuTarget = 60
+	}
+	if c.NetworkType == "" {
+		c.NetworkType = "ipv4"
+	}
+	if c.IpDiscovery == "" {
+		c.IpDiscovery = "ipv4"
+		if c.NetworkType == "ipv6" {
+			c.IpDiscovery = "ipv6"
+		}
+	}
+	if c.AppReplicas == 0 {
+		c.AppReplicas = eksDesiredNodeCount
+	}
+	if c.LogRetentionDays == 0 {
+		c.LogRetentionDays = 7
+	}
+	if c.AppImage == "" {
+		c.AppImage = "redis-failover-app:latest"
+	}
+	if c.AppInitImage == "" {
+		c.AppInitImage = "alpine/openssl:3.1.4"
+	}
+	if c.RedisWaitTimeoutSeconds == 0 {
+		c.RedisWaitTimeoutSeconds = 300
+	}
+	if c.ChaosPartitionDuration == "" {
+		c.ChaosPartitionDuration = "60s"
+	}
+	if c.LettuceRefreshPeriod == "" {
+		c.LettuceRefreshPeriod = "30s"
+	}
+	if c.InitialSnapshotName == "" {
+		c.InitialSnapshotName = "redis-failover-lab-initial"
+	}
+	if c.DashboardGrouping == "" {
+		c.DashboardGrouping = "by-shard"
+	}
+	if c.AlarmNamePrefix == "" {
+		c.AlarmNamePrefix = "redis-failover-lab"
+	}
+	if c.NodeGroupType == "" {
+		c.NodeGroupType = "selfManaged"
+	}
+	if c.EksReadyTimeout == 0 {
+		c.EksReadyTimeout = 600
+	}
+	if c.HealthGateTimeout == 0 {
+		c.HealthGateTimeout = 600
+	}
+	if len(c.HealthGateChecks) == 0 {
+		c.HealthGateChecks = healthGateChecks
+	}
+	if c.HealthGateMaxReplicationLag == 0 {
+		c.HealthGateMaxReplicationLag = 5
+	}
+	if len(c.ShardReplicas) == 0 {
+		for shard := 0; shard < numShards; shard++ {
+			c.ShardReplicas = append(c.ShardReplicas, replicasPerShard)
+		}
+	}
+	if c.SeedKeyCount == 0 {
+		c.SeedKeyCount = 10000
+	}
+	if c.FailoverReportWindowHours == 0 {
+		c.FailoverReportWindowHours = 24
+	}
+	if c.LatencyPeriod == 0 {
+		c.LatencyPeriod = 60
+	}
+	if c.FailoverShardIndex == 0 {
+		c.FailoverShardIndex = 1
+	}
+	if c.FailedOpsAlarmWindowSeconds == 0 {
+		c.FailedOpsAlarmWindowSeconds = 60
+	}
+	if c.Encryption == nil {
+		encryption := true
+		c.Encryption = &encryption
+	}
+	if c.SkipFinalSnapshot == nil {
+		skipFinalSnapshot := true
+		c.SkipFinalSnapshot = &skipFinalSnapshot
+	}
+	if c.ApplyImmediately == nil {
+		applyImmediately := !c.DeferMaintenance
+		c.ApplyImmediately = &applyImmediately
+	}
+}
@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// hoursPerMonth is the AWS pricing convention for monthly estimates
+const hoursPerMonth = 730
+
+// priceTable holds approximate on-demand hourly USD prices keyed by instance or
+// node type, plus eks-cluster and nat-gateway
+//
+//go:embed prices.json
+var priceTable []byte
+
+// reservedNodeTable maps reservable node types to their family and size-flexibility
+// normalization units
+//
+//go:embed reserved_nodes.json
+var reservedNodeTable []byte
+
+// CostEstimate is a rough monthly USD figure for the lab's billable resources
+type CostEstimate struct {
+	TotalUsd  float64            `json:"totalUsd"`
+	Breakdown map[string]float64 `json:"breakdown"`
+	// Unpriced lists the items left out of TotalUsd for want of a price
+	Unpriced []string `json:"unpriced"`
+	Note     string   `json:"note"`
+}
+
+// EstimateMonthlyCost approximates the lab's monthly cost from the resolved cluster node
+// types and counts, the EKS control plane and nodes, and natGateways NAT gateways
+// overrides replace or extend the embedded hourly price table. Items with no price,
+// such as a node type newer than the table, are listed as unpriced rather than failing
+func EstimateMonthlyCost(cfg *LabConfig, natGateways int) (*CostEstimate, error) {
+	prices := map[string]interface{}{}
+	if err := json.Unmarshal(priceTable, &prices); err != nil {
+		return nil, fmt.Errorf("invalid embedded price table: %w", err)
+	}
+	for key, price := range cfg.PriceOverrides {
+		prices[key] = price
+	}
+	breakdown := map[string]float64{}
+	unpriced := []string{}
+	add := func(item, priceKey string, count int) {
+		price, ok := prices[priceKey].(float64)
+		if !ok {
+			unpriced = append(unpriced, item)
+			return
+		}
+		breakdown[item] += math.Round(price*float64(count)*hoursPerMonth*100) / 100
+	}
+
+	shardReplicas, err := withReplicaOverrides(cfg.ShardReplicas, cfg.ReplicaOverrides)
+	if err != nil {
+		return nil, err
+	}
+	nodesPerCluster := len(nodeSuffixes(shardReplicas))
+	for _, cluster := range cfg.Clusters {
+		add(fmt.Sprintf("elasticache-%s (%d x %s)", cluster.Key, nodesPerCluster, cluster.NodeType), cluster.NodeType, nodesPerCluster)
+	}
+	add("eks-control-plane", "eks-cluster", 1)
+	add(fmt.Sprintf("eks-nodes (%d x %s)", eksDesiredNodeCount, eksInstanceType), eksInstanceType, eksDesiredNodeCount)
+	if natGateways > 0 {
+		add(fmt.Sprintf("nat-gateways (%d)", natGateways), "nat-gateway", natGateways)
+	}
+
+	var total float64
+	for _, cost := range breakdown {
+		total += cost
+	}
+	return &CostEstimate{
+		TotalUsd:  math.Round(total*100) / 100,
+		Breakdown: breakdown,
+		Unpriced:  unpriced,
+		Note:      "Rough on-demand estimate excluding data transfer, storage, snapshots and CloudWatch; not a quote",
+	}, nil
+}
+
+// ReservedNodeRecommendation is one reserved-node purchase covering the lab's nodes
+type ReservedNodeRecommendation struct {
+	ReservedNodeType string   `json:"reservedNodeType"`
+	Count            int      `json:"count"`
+	Covers           []string `json:"covers"`
+}
+
+// reservableNode is a reserved node table entry
+type reservableNode struct {
+	Family string `json:"family"`
+	Units  int    `json:"units"`
+}
+
+// reservableNodes is the reserved node table keyed by node type
+type reservableNodes map[string]reservableNode
+
+// RecommendReservedNodes sizes the reserved nodes that would cover every cluster's
+// nodes for a long-running lab. Reservations are size-flexible within a family, so
+// each family's nodes are summed in normalization units and expressed in its
+// smallest node type in use. cfg.ReservedNodeOverrides replace or extend the
+// embedded table; clusters whose node type is in neither are returned as unpriced.
+// Advisory only; nothing is purchased
+func RecommendReservedNodes(cfg *LabConfig) ([]ReservedNodeRecommendation, []string, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(reservedNodeTable, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid embedded reserved node table: %w", err)
+	}
+	table := reservableNodes{}
+	for nodeType, entry := range raw {
+		var node reservableNode
+		if err := json.Unmarshal(entry, &node); err == nil {
+			table[nodeType] = node
+		}
+	}
+	for nodeType, node := range cfg.ReservedNodeOverrides {
+		table[nodeType] = node
+	}
+
+	units := map[string]int{}
+	smallest := map[string]string{}
+	covers := map[string][]string{}
+	unpriced := []string{}
+	shardReplicas, err := withReplicaOverrides(cfg.ShardReplicas, cfg.ReplicaOverrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodesPerCluster := len(nodeSuffixes(shardReplicas))
+	for _, cluster := range cfg.Clusters {
+		item := fmt.Sprintf("%s (%d x %s)", cluster.Key, nodesPerCluster, cluster.NodeType)
+		node, ok := table[cluster.NodeType]
+		if !ok {
+			unpriced = append(unpriced, item)
+			continue
+		}
+		units[node.Family] += nodesPerCluster * node.Units
+		if current, ok := smallest[node.Family]; !ok || node.Units < table[current].Units {
+			smallest[node.Family] = cluster.NodeType
+		}
+		covers[node.Family] = append(covers[node.Family], item)
+	}
+
+	recommendations := make([]ReservedNodeRecommendation, 0, len(units))
+	for family, total := range units {
+		reservedType := smallest[family]
+		recommendations = append(recommendations, ReservedNodeRecommendation{
+			ReservedNodeType: reservedType,
+			Count:            int(math.Ceil(float64(total) / float64(table[reservedType].Units))),
+			Covers:           covers[family],
+		})
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].ReservedNodeType < recommendations[j].ReservedNodeType
+	})
+	return recommendations, unpriced, nil
+}
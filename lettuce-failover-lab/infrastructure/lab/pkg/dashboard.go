@@ -0,0 +1,701 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dashboardMetric is one series on a dashboard widget
+// dimensions are name/value pairs in CloudWatch metric array order
+type dashboardMetric struct {
+	namespace  string
+	name       string
+	dimensions []string
+	label      string
+	stat       string
+	yAxis      string
+	// sumOver is a further dimension the metric is only published with; the series
+	// sums it over every value of that dimension
+	sumOver string
+}
+
+// dashboardOutputs are the resolved stack outputs the dashboards are rendered from
+type dashboardOutputs struct {
+	replicationGroupId string
+	// nodeAzs maps node suffixes to AZs when grouping by AZ, empty otherwise
+	nodeAzs map[string]string
+	// eksClusterName adds the EKS node panels when non-empty
+	eksClusterName string
+	// runId filters the app and observer series when non-empty
+	runId string
+}
+
+// dashboardWidget is one time-series panel, laid out on the shared 24-column grid
+type dashboardWidget struct {
+	title       string
+	x, y        int
+	width       int
+	height      int
+	period      int
+	metrics     []dashboardMetric
+	annotations bool // show failover annotations and the zero-gap baseline
+	// category groups widgets for per-category settings: elasticache, application,
+	// observer, highResolution or eks
+	category string
+}
+
+// withCategory sets the category of every widget in widgets
+func withCategory(category string, widgets ...dashboardWidget) []dashboardWidget {
+	for i := range widgets {
+		widgets[i].category = category
+	}
+	return widgets
+}
+
+// widgetStacked reports whether w is drawn stacked: its category's dashboardStacked
+// entry, else the all entry, else false
+func widgetStacked(stacked map[string]bool, w dashboardWidget) bool {
+	if value, ok := stacked[w.category]; ok {
+		return value
+	}
+	return stacked["all"]
+}
+
+// shardMetrics returns one ElastiCache series per shard, keyed by the shard's first node
+func shardMetrics(replicationGroupId, metricName, labelFormat, stat string) []dashboardMetric {
+	metrics := make([]dashboardMetric, 0, numShards)
+	for shard := 1; shard <= numShards; shard++ {
+		metrics = append(metrics, dashboardMetric{
+			namespace:  "AWS/ElastiCache",
+			name:       metricName,
+			dimensions: []string{"CacheClusterId", fmt.Sprintf("%s-%04d-001", replicationGroupId, shard)},
+			label:      fmt.Sprintf(labelFormat, shard),
+			stat:       stat,
+		})
+	}
+	return metrics
+}
+
+// allShardsPattern is the shard ID part of the SEARCH expressions shard widgets query
+// with the shard variable, matching every shard (000[1-3]); picking a shard
+// replaces it with that shard's ID
+var allShardsPattern = fmt.Sprintf("000[1-%d]", numShards)
+
+// shardSearchExpression returns a SEARCH over m's metric on the first node of every
+// shard allShardsPattern matches, one series each, at the widget period
+func shardSearchExpression(replicationGroupId string, m dashboardMetric, period int) string {
+	stat := m.stat
+	if stat == "" {
+		stat = "Average"
+	}
+	return fmt.Sprintf(`SEARCH('{AWS/ElastiCache,CacheClusterId} MetricName="%s" CacheClusterId=/^%s-%s-001$/', '%s', %d)`,
+		m.name, replicationGroupId, allShardsPattern, stat, period)
+}
+
+// shardVariable is the dashboard's shard picker, defaulting to all shards
+func shardVariable() map[string]interface{} {
+	values := []map[string]string{{"value": allShardsPattern, "label": "All shards"}}
+	for shard := 1; shard <= numShards; shard++ {
+		values = append(values, map[string]string{"value": fmt.Sprintf("%04d", shard), "label": fmt.Sprintf("Shard %d", shard)})
+	}
+	return map[string]interface{}{
+		"type":         "pattern",
+		"pattern":      regexp.QuoteMeta(allShardsPattern),
+		"inputType":    "select",
+		"id":           "shard",
+		"label":        "Shard",
+		"defaultValue": allShardsPattern,
+		"visible":      true,
+		"values":       values,
+	}
+}
+
+// sumOverExpression returns a SUM of a SEARCH for m's metric over every value of
+// m.sumOver, at the widget period
+func sumOverExpression(m dashboardMetric, period int) string {
+	stat := m.stat
+	if stat == "" {
+		stat = "Average"
+	}
+	schema := []string{m.namespace}
+	filters := []string{fmt.Sprintf("MetricName=%q", m.name)}
+	for k := 0; k+1 < len(m.dimensions); k += 2 {
+		schema = append(schema, m.dimensions[k])
+		filters = append(filters, fmt.Sprintf("%s=%q", m.dimensions[k], m.dimensions[k+1]))
+	}
+	schema = append(schema, m.sumOver)
+	return fmt.Sprintf("SUM(SEARCH('{%s} %s', '%s', %d))", strings.Join(schema, ","), strings.Join(filters, " "), stat, period)
+}
+
+// appMetric returns a series for a custom metric published by the failover app
+func appMetric(name, label string) dashboardMetric {
+	return dashboardMetric{namespace: labMetricsNamespace, name: name, label: label}
+}
+
+// withRunId filters every app and observer series in widgets to the RunId dimension
+// runId, the run the app and observer tag their metrics with
+func withRunId(widgets []dashboardWidget, runId string) []dashboardWidget {
+	for i := range widgets {
+		metrics := make([]dashboardMetric, len(widgets[i].metrics))
+		for j, m := range widgets[i].metrics {
+			if m.namespace == labMetricsNamespace {
+				m.dimensions = append(append([]string{}, m.dimensions...), "RunId", runId)
+			}
+			metrics[j] = m
+		}
+		widgets[i].metrics = metrics
+	}
+	return widgets
+}
+
+// runIdVariable is the dashboard's run field, defaulting to runId; entering another
+// run's ID charts the app and observer metrics of that run
+func runIdVariable(runId string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":         "property",
+		"property":     "RunId",
+		"inputType":    "input",
+		"id":           "runId",
+		"label":        "Run",
+		"defaultValue": runId,
+		"visible":      true,
+	}
+}
+
+// nodeMetrics returns one ElastiCache series per node in nodes (shard/node suffixes
+// such as 0001-002), labelled by shard and node; node 1 is the primary at creation
+func nodeMetrics(replicationGroupId, metricName, stat string, nodes []string) []dashboardMetric {
+	metrics := make([]dashboardMetric, 0, len(nodes))
+	for _, node := range nodes {
+		var shard, member int
+		fmt.Sscanf(node, "%04d-%03d", &shard, &member)
+		metrics = append(metrics, dashboardMetric{
+			namespace:  "AWS/ElastiCache",
+			name:       metricName,
+			dimensions: []string{"CacheClusterId", fmt.Sprintf("%s-%s", replicationGroupId, node)},
+			label:      fmt.Sprintf("Shard %d Node %d", shard, member),
+			stat:       stat,
+		})
+	}
+	return metrics
+}
+
+// azWidgets lays out one row per AZ with the ElastiCache metrics of the nodes placed
+// there, so the impact of losing an AZ reads off a single row
+// nodeAzs maps node suffixes (0001-001) to their AZ
+func azWidgets(replicationGroupId string, nodeAzs map[string]string) []dashboardWidget {
+	nodesByAz := map[string][]string{}
+	for node, az := range nodeAzs {
+		nodesByAz[az] = append(nodesByAz[az], node)
+	}
+	azs := make([]string, 0, len(nodesByAz))
+	for az, nodes := range nodesByAz {
+		sort.Strings(nodes)
+		azs = append(azs, az)
+	}
+	sort.Strings(azs)
+
+	var widgets []dashboardWidget
+	for i, az := range azs {
+		y := 1 + i*6
+		nodes := nodesByAz[az]
+		widgets = append(widgets,
+			dashboardWidget{
+				title: az + " - Replication Lag", x: 0, y: y, width: 6, height: 6, period: 60,
+				metrics: nodeMetrics(replicationGroupId, "ReplicationLag", "", nodes),
+			},
+			dashboardWidget{
+				title: az + " - Current Connections", x: 6, y: y, width: 6, height: 6, period: 60,
+				metrics: nodeMetrics(replicationGroupId, "CurrConnections", "", nodes),
+			},
+			dashboardWidget{
+				title: az + " - CPU Utilization", x: 12, y: y, width: 6, height: 6, period: 60,
+				metrics: nodeMetrics(replicationGroupId, "CPUUtilization", "", nodes),
+			},
+			dashboardWidget{
+				title: az + " - New Connections", x: 18, y: y, width: 6, height: 6, period: 60,
+				metrics: nodeMetrics(replicationGroupId, "NewConnections", "Sum", nodes),
+			},
+		)
+	}
+	return widgets
+}
+
+// latencySampleMetric is the per-interval average latency each app pod publishes;
+// extended statistics are computed server-side over these samples
+const latencySampleMetric = "operations.latency.avg"
+
+// latencyWidget shows the app's published P50/P99/max latency at the app period, or
+// with latencyStats set, those extended statistics (p95, p99.9, tm99, ...) of
+// latencySampleMetric over latencyPeriod
+func latencyWidget(top int, latencyStats []string, latencyPeriod int) dashboardWidget {
+	if len(latencyStats) == 0 {
+		return dashboardWidget{
+			title: "Application - Operation Latency", x: 12, y: top, width: 12, height: 6, period: 10,
+			metrics: []dashboardMetric{
+				appMetric("operations.latency.p50.ms", "P50 Latency"),
+				appMetric("operations.latency.p99.ms", "P99 Latency"),
+				appMetric("operations.latency.max.ms", "Max Latency"),
+			},
+		}
+	}
+
+	metrics := make([]dashboardMetric, 0, len(latencyStats))
+	for _, stat := range latencyStats {
+		metric := appMetric(latencySampleMetric, strings.ToUpper(stat)+" Latency")
+		metric.stat = stat
+		metrics = append(metrics, metric)
+	}
+	return dashboardWidget{
+		title: "Application - Operation Latency", x: 12, y: top, width: 12, height: 6, period: latencyPeriod,
+		metrics: metrics,
+	}
+}
+
+// applicationWidgets are the failover app panels, 18 rows tall starting at row top
+func applicationWidgets(top int, latencyStats []string, latencyPeriod int) []dashboardWidget {
+	sequenceGaps := appMetric("getset.sequence.gaps", "Sequence Gaps")
+	sequenceGaps.stat = "Sum"
+	topologyRefreshes := appMetric("topology.refresh.count", "Topology Refreshes")
+	topologyRefreshes.stat = "Sum"
+	topologyRefreshes.yAxis = "right"
+
+	return []dashboardWidget{
+		{
+			title: "Application - Failover Metrics", x: 0, y: top, width: 12, height: 6, period: 10,
+			metrics: []dashboardMetric{
+				appMetric("connection.drop.duration.ms", "Connection Drop Duration"),
+				appMetric("topology.refresh.count", "Topology Refresh Count"),
+				appMetric("operations.failed.during.failover", "Failed Operations"),
+			},
+		},
+		latencyWidget(top, latencyStats, latencyPeriod),
+		{
+			title: "Pub/Sub Metrics", x: 0, y: top + 6, width: 8, height: 6, period: 10,
+			metrics: []dashboardMetric{
+				appMetric("pubsub.messages.published", "Published"),
+				appMetric("pubsub.messages.received", "Received"),
+				appMetric("pubsub.message.loss.count", "Lost"),
+			},
+		},
+		{
+			title: "Streams Metrics", x: 8, y: top + 6, width: 8, height: 6, period: 10,
+			metrics: []dashboardMetric{
+				appMetric("streams.messages.added", "Added"),
+				appMetric("streams.messages.consumed", "Consumed"),
+				appMetric("streams.lag.ms", "Lag (ms)"),
+			},
+		},
+		{
+			title: "GET/SET Operations", x: 16, y: top + 6, width: 8, height: 6, period: 10,
+			metrics: []dashboardMetric{
+				appMetric("getset.operations.success", "Success"),
+				appMetric("getset.operations.failed", "Failed"),
+				appMetric("getset.sequence.gaps", "Sequence Gaps"),
+			},
+		},
+		{
+			title: "Data Integrity - Sequence Gaps vs Failovers", x: 0, y: top + 12, width: 24, height: 6, period: 10,
+			metrics:     []dashboardMetric{sequenceGaps, topologyRefreshes},
+			annotations: true,
+		},
+	}
+}
+
+// eksWidgets is a row of Container Insights panels at row top, to tell node pressure
+// apart from failover effects
+func eksWidgets(clusterName string, top int) []dashboardWidget {
+	metric := func(name, label, stat string, dimensions ...string) dashboardMetric {
+		return dashboardMetric{
+			namespace:  "ContainerInsights",
+			name:       name,
+			dimensions: append([]string{"ClusterName", clusterName}, dimensions...),
+			label:      label,
+			stat:       stat,
+		}
+	}
+	// Pod metrics are only published per pod, so they are summed over the namespace
+	podMetric := func(name, label, stat, namespace string) dashboardMetric {
+		m := metric(name, label, stat, "Namespace", namespace)
+		m.sumOver = "PodName"
+		return m
+	}
+	return []dashboardWidget{
+		{
+			title: "EKS - Node CPU Utilization", x: 0, y: top, width: 8, height: 6, period: 60,
+			metrics: []dashboardMetric{
+				metric("node_cpu_utilization", "Max", "Maximum"),
+				metric("node_cpu_utilization", "Average", "Average"),
+			},
+		},
+		{
+			title: "EKS - Node Memory Utilization", x: 8, y: top, width: 8, height: 6, period: 60,
+			metrics: []dashboardMetric{
+				metric("node_memory_utilization", "Max", "Maximum"),
+				metric("node_memory_utilization", "Average", "Average"),
+			},
+		},
+		{
+			title: "EKS - Pod Restarts", x: 16, y: top, width: 8, height: 6, period: 60,
+			metrics: []dashboardMetric{
+				podMetric("pod_number_of_container_restarts", "Lab Pods", "Sum", "redis-failover-lab"),
+				podMetric("pod_number_of_container_restarts", "App Pods", "Sum", appNamespace),
+			},
+		},
+	}
+}
+
+// metricResolutions is the finest period, in seconds, each metric source publishes
+// at: ElastiCache and Container Insights every minute, the app's Micrometer registry
+// every 10s (application.yml step) and the observer at one-second storage resolution
+// Entries for namespace/metric override the namespace
+var metricResolutions = map[string]int{
+	"AWS/ElastiCache":   60,
+	"ContainerInsights": 60,
+	"RedisFailoverLab":  10,
+	"RedisFailoverLab/observer.failover.detected.ms": 1,
+}
+
+// metricResolution returns the finest period m is published at, 0 if unknown
+func metricResolution(m dashboardMetric) int {
+	if resolution, ok := metricResolutions[m.namespace+"/"+m.name]; ok {
+		return resolution
+	}
+	return metricResolutions[m.namespace]
+}
+
+// checkWidgetPeriods rejects widgets whose period is finer than one of their
+// metrics is published at, which would chart sparse points rather than more detail
+func checkWidgetPeriods(widgets []dashboardWidget) error {
+	for _, w := range widgets {
+		for _, m := range w.metrics {
+			if resolution := metricResolution(m); w.period < resolution {
+				return fmt.Errorf("dashboard widget %q: period %ds is finer than the %ds resolution of %s %s", w.title, w.period, resolution, m.namespace, m.name)
+			}
+		}
+	}
+	return nil
+}
+
+// highResolutionWidgets is a row at row top charting failover metrics at their
+// finest period, for the sub-minute dynamics a 60s period smooths away. ElastiCache
+// metrics are only published every minute, so the row holds observer and app metrics
+func highResolutionWidgets(top int) []dashboardWidget {
+	detection := appMetric("observer.failover.detected.ms", "Failover Detected (ms)")
+	detection.stat = "Maximum"
+	drop := appMetric("connection.drop.duration.ms", "Connection Drop Duration")
+	drop.stat = "Maximum"
+	failed := appMetric("operations.failed.during.failover", "Failed Operations")
+	failed.stat = "Sum"
+	failed.yAxis = "right"
+	return []dashboardWidget{
+		{
+			title: "High Resolution - Failover Detection", x: 0, y: top, width: 12, height: 6, period: metricResolution(detection),
+			metrics: []dashboardMetric{detection},
+		},
+		{
+			title: "High Resolution - Connection Drops", x: 12, y: top, width: 12, height: 6, period: metricResolution(drop),
+			metrics: []dashboardMetric{drop, failed},
+		},
+	}
+}
+
+// labDashboardWidgets is the single widget list both the CloudWatch and Grafana
+// dashboards are rendered from, so the two stay in sync
+// Empty nodeAzs groups ElastiCache metrics by shard; otherwise they are grouped by AZ
+// cfg.HighResMetrics adds a row of panels at each metric's finest period
+// A non-empty eksClusterName adds a row of EKS node panels at the bottom, and a
+// non-empty runId filters the app and observer series to that run
+func labDashboardWidgets(cfg *LabConfig, outputs dashboardOutputs) []dashboardWidget {
+	replicationGroupId, nodeAzs := outputs.replicationGroupId, outputs.nodeAzs
+	var widgets []dashboardWidget
+	top := 7
+	if len(nodeAzs) == 0 {
+		widgets = withCategory("elasticache",
+			dashboardWidget{
+				title: "ElastiCache - Replication Lag", x: 0, y: 1, width: 8, height: 6, period: 60,
+				metrics: shardMetrics(replicationGroupId, "ReplicationLag", "Shard %d Replica", ""),
+			},
+			dashboardWidget{
+				title: "ElastiCache - Current Connections", x: 8, y: 1, width: 8, height: 6, period: 60,
+				metrics: shardMetrics(replicationGroupId, "CurrConnections", "Shard %d Primary", ""),
+			},
+			dashboardWidget{
+				title: "ElastiCache - CPU Utilization", x: 16, y: 1, width: 8, height: 6, period: 60,
+				metrics: shardMetrics(replicationGroupId, "CPUUtilization", "Shard %d", ""),
+			},
+		)
+	} else {
+		widgets = withCategory("elasticache", azWidgets(replicationGroupId, nodeAzs)...)
+		top = 1 + len(widgets)/4*6
+	}
+
+	widgets = append(widgets, withCategory("application", applicationWidgets(top, cfg.LatencyStatistics, cfg.LatencyPeriod)...)...)
+	top += 18
+
+	// By AZ, new connections are already part of each AZ row
+	if len(nodeAzs) == 0 {
+		widgets = append(widgets, dashboardWidget{
+			title: "ElastiCache - New Connections", x: 0, y: top, width: 24, height: 6, period: 60,
+			metrics:  shardMetrics(replicationGroupId, "NewConnections", "Shard %d", "Sum"),
+			category: "elasticache",
+		})
+		top += 6
+	}
+
+	observerDetection := appMetric("observer.failover.detected.ms", "Failover Detected (ms)")
+	observerDetection.stat = "Maximum"
+	widgets = append(widgets, dashboardWidget{
+		title: "Observer - Failover Detection", x: 0, y: top, width: 24, height: 6, period: 10,
+		metrics:  []dashboardMetric{observerDetection},
+		category: "observer",
+	})
+	top += 6
+
+	if cfg.HighResMetrics {
+		widgets = append(widgets, withCategory("highResolution", highResolutionWidgets(top)...)...)
+		top += 6
+	}
+
+	if outputs.eksClusterName != "" {
+		widgets = append(widgets, withCategory("eks", eksWidgets(outputs.eksClusterName, top)...)...)
+	}
+	if outputs.runId != "" {
+		widgets = withRunId(widgets, outputs.runId)
+	}
+	return widgets
+}
+
+// failoverAnnotationsBlock renders the widget annotations block for failover events
+// CloudWatch only supports time markers as vertical annotations, so failover
+// timestamps are rendered there alongside a horizontal zero-gap baseline
+func failoverAnnotationsBlock(annotations []FailoverAnnotation) map[string]interface{} {
+	vertical := make([]map[string]string, 0, len(annotations))
+	for _, a := range annotations {
+		vertical = append(vertical, map[string]string{
+			"label": a.Label,
+			"value": a.Value,
+			"color": "#d62728",
+		})
+	}
+	return map[string]interface{}{
+		"horizontal": []map[string]interface{}{
+			{"label": "No gaps", "value": 0},
+		},
+		"vertical": vertical,
+	}
+}
+
+// cloudwatchDashboardJSON renders the lab widgets as a CloudWatch dashboard body
+// querying cfg.Region. An empty cfg.DashboardStart or cfg.DashboardPeriodOverride
+// keeps the CloudWatch default (-PT3H, auto). cfg.DashboardStacked maps widget
+// categories, or all, to a stacked view. A non-empty runId is shown in the title
+// and charted through a run field, to tell which run's resources and metrics are
+// shown. cfg.DashboardShardFilter, when grouping by shard, adds a shard picker
+// filtering every ElastiCache widget, which then chart a SEARCH over the shards
+func cloudwatchDashboardJSON(cfg *LabConfig, outputs dashboardOutputs) (string, error) {
+	replicationGroupId, nodeAzs, runId := outputs.replicationGroupId, outputs.nodeAzs, outputs.runId
+	labWidgets := labDashboardWidgets(cfg, outputs)
+	if err := checkWidgetPeriods(labWidgets); err != nil {
+		return "", err
+	}
+	title := "# Lettuce Failover Lab Dashboard"
+	if runId != "" {
+		title += fmt.Sprintf(" · run `%s` (RunId tag and metric dimension)", runId)
+	}
+	widgets := []map[string]interface{}{
+		{
+			"type":   "text",
+			"x":      0,
+			"y":      0,
+			"width":  24,
+			"height": 1,
+			"properties": map[string]interface{}{
+				"markdown": title,
+			},
+		},
+	}
+	for _, w := range labWidgets {
+		metrics := make([][]interface{}, 0, len(w.metrics))
+		for j, m := range w.metrics {
+			if m.sumOver != "" {
+				metrics = append(metrics, []interface{}{map[string]interface{}{
+					"id":         fmt.Sprintf("e%d", j+1),
+					"expression": sumOverExpression(m, w.period),
+					"label":      m.label,
+				}})
+				continue
+			}
+			row := []interface{}{m.namespace, m.name}
+			for _, d := range m.dimensions {
+				row = append(row, d)
+			}
+			options := map[string]string{"label": m.label}
+			if m.stat != "" {
+				options["stat"] = m.stat
+			}
+			if m.yAxis != "" {
+				options["yAxis"] = m.yAxis
+			}
+			metrics = append(metrics, append(row, options))
+		}
+		if cfg.DashboardShardFilter && len(nodeAzs) == 0 && w.metrics[0].namespace == "AWS/ElastiCache" {
+			metrics = [][]interface{}{{map[string]interface{}{
+				"id":         "shards",
+				"expression": shardSearchExpression(replicationGroupId, w.metrics[0], w.period),
+			}}}
+		}
+
+		properties := map[string]interface{}{
+			"title":   w.title,
+			"view":    "timeSeries",
+			"stacked": widgetStacked(cfg.DashboardStacked, w),
+			"metrics": metrics,
+			"region":  cfg.Region,
+			"period":  w.period,
+		}
+		if w.annotations {
+			properties["annotations"] = failoverAnnotationsBlock(cfg.FailoverAnnotations)
+		}
+		widgets = append(widgets, map[string]interface{}{
+			"type":       "metric",
+			"x":          w.x,
+			"y":          w.y,
+			"width":      w.width,
+			"height":     w.height,
+			"properties": properties,
+		})
+	}
+
+	body := map[string]interface{}{"widgets": widgets}
+	var variables []map[string]interface{}
+	if cfg.DashboardShardFilter && len(nodeAzs) == 0 {
+		variables = append(variables, shardVariable())
+	}
+	if runId != "" {
+		variables = append(variables, runIdVariable(runId))
+	}
+	if len(variables) > 0 {
+		body["variables"] = variables
+	}
+	if cfg.DashboardStart != "" {
+		body["start"] = cfg.DashboardStart
+	}
+	if cfg.DashboardPeriodOverride != "" {
+		body["periodOverride"] = cfg.DashboardPeriodOverride
+	}
+	bytes, err := json.Marshal(body)
+	return string(bytes), err
+}
+
+// grafanaDashboardJSON renders the lab widgets as an importable Grafana dashboard
+// using the CloudWatch datasource. Failover annotations are CloudWatch-only; the
+// zero-gap baseline is carried over as a threshold, and the CloudWatch start as
+// the default time range. cfg.DashboardStacked stacks panels as on the CloudWatch
+// dashboard, and a non-empty runId becomes a runId:<id> dashboard tag and the
+// default of a run variable the app and observer series are filtered on
+func grafanaDashboardJSON(cfg *LabConfig, outputs dashboardOutputs) (string, error) {
+	runId := outputs.runId
+	labWidgets := labDashboardWidgets(cfg, outputs)
+	if err := checkWidgetPeriods(labWidgets); err != nil {
+		return "", err
+	}
+	panels := make([]map[string]interface{}, 0)
+	for i, w := range labWidgets {
+		targets := make([]map[string]interface{}, 0, len(w.metrics))
+		for j, m := range w.metrics {
+			dimensions := map[string]string{}
+			for k := 0; k+1 < len(m.dimensions); k += 2 {
+				dimensions[m.dimensions[k]] = m.dimensions[k+1]
+			}
+			if _, ok := dimensions["RunId"]; ok {
+				dimensions["RunId"] = "$runId"
+			}
+			stat := m.stat
+			if stat == "" {
+				stat = "Average"
+			}
+			target := map[string]interface{}{
+				"refId":      string(rune('A' + j)),
+				"datasource": map[string]string{"type": "cloudwatch", "uid": "${datasource}"},
+				"namespace":  m.namespace,
+				"metricName": m.name,
+				"dimensions": dimensions,
+				"statistic":  stat,
+				"period":     fmt.Sprint(w.period),
+				"region":     cfg.Region,
+				"label":      m.label,
+				"matchExact": true,
+			}
+			// Summed series run the same expression as on CloudWatch, in code mode
+			if m.sumOver != "" {
+				target["metricEditorMode"] = 1
+				target["expression"] = sumOverExpression(m, w.period)
+			}
+			targets = append(targets, target)
+		}
+
+		defaults := map[string]interface{}{}
+		custom := map[string]interface{}{}
+		if w.annotations {
+			custom["thresholdsStyle"] = "line"
+			defaults["thresholds"] = map[string]interface{}{
+				"mode":  "absolute",
+				"steps": []map[string]interface{}{{"color": "green", "value": nil}, {"color": "red", "value": 0}},
+			}
+		}
+		if widgetStacked(cfg.DashboardStacked, w) {
+			custom["stacking"] = map[string]string{"mode": "normal", "group": "A"}
+		}
+		if len(custom) > 0 {
+			defaults["custom"] = custom
+		}
+		fieldConfig := map[string]interface{}{"defaults": defaults}
+		panels = append(panels, map[string]interface{}{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       w.title,
+			"gridPos":     map[string]int{"x": w.x, "y": w.y, "w": w.width, "h": w.height},
+			"datasource":  map[string]string{"type": "cloudwatch", "uid": "${datasource}"},
+			"targets":     targets,
+			"fieldConfig": fieldConfig,
+		})
+	}
+
+	from := "now-1h"
+	if cfg.DashboardStart != "" {
+		from = grafanaTimeFrom(cfg.DashboardStart)
+	}
+	templating := []map[string]interface{}{
+		{"name": "datasource", "type": "datasource", "query": "cloudwatch", "label": "CloudWatch"},
+	}
+	dashboard := map[string]interface{}{
+		"title":         "Lettuce Failover Lab",
+		"uid":           "redis-failover-lab",
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": from, "to": "now"},
+		"panels":        panels,
+	}
+	if runId != "" {
+		dashboard["tags"] = []string{"runId:" + runId}
+		templating = append(templating, map[string]interface{}{
+			"name":    "runId",
+			"type":    "textbox",
+			"label":   "Run",
+			"query":   runId,
+			"current": map[string]string{"text": runId, "value": runId},
+		})
+	}
+	dashboard["templating"] = map[string]interface{}{"list": templating}
+	bytes, err := json.MarshalIndent(dashboard, "", "  ")
+	return string(bytes), err
+}
+
+// grafanaTimeFrom converts a relative CloudWatch start (-PT3H, -P7D) to the
+// equivalent Grafana time range start (now-3h, now-7d)
+func grafanaTimeFrom(start string) string {
+	return "now-" + strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(start, "-P"), "T"))
+}
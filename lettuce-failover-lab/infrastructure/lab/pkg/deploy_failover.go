@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// deployFailoverSource starts TestFailover on one shard and returns without waiting
+// for the promotion, recording when it was requested
+const deployFailoverSource = `from datetime import datetime, timezone
+
+import boto3
+
+elasticache = boto3.client("elasticache")
+
+
+def handler(event, context):
+    shard = "%04d" % event["shard"]
+    started = datetime.now(timezone.utc).strftime("%Y-%m-%dT%H:%M:%SZ")
+    elasticache.test_failover(
+        ReplicationGroupId=event["replicationGroupId"],
+        NodeGroupId=shard,
+    )
+    return {"shard": shard, "startTime": started}
+`
+
+type DeployFailoverResult struct {
+	// StartTime is when TestFailover was requested, e.g. 2025-01-15T10:30:00Z
+	StartTime pulumi.StringOutput
+}
+
+// TriggerFailoverOnDeploy runs TestFailover on shard cfg.FailoverShardIndex once the
+// replication group is available, as a smoke test of the whole pipeline. It runs
+// on create and again whenever the shard changes; a refused failover, e.g. one
+// already in progress, fails pulumi up
+func TriggerFailoverOnDeploy(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, clusterKey string, redis *ElastiCacheResult) (*DeployFailoverResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-deploy-failover-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-deploy-failover-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-deploy-failover-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	failoverPolicy, err := iam.NewRolePolicy(ctx, prefix+"-deploy-failover-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: redis.ReplicationGroupArn.ApplyT(func(arn string) (string, error) {
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect":   "Allow",
+						"Action":   "elasticache:TestFailover",
+						"Resource": arn,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-deploy-failover", &lambda.FunctionArgs{
+		Description: pulumi.String("Starts a Failover Lab TestFailover after deploy"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(60),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(deployFailoverSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-deploy-failover"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, failoverPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := redis.ReplicationGroupId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"replicationGroupId": id,
+			"shard":              cfg.FailoverShardIndex,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	invocation, err := lambda.NewInvocation(ctx, prefix+"-deploy-failover", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeployFailoverResult{
+		StartTime: invocation.Result.ApplyT(func(result string) (string, error) {
+			var status struct {
+				StartTime string `json:"startTime"`
+			}
+			err := json.Unmarshal([]byte(result), &status)
+			return status.StartTime, err
+		}).(pulumi.StringOutput),
+	}, nil
+}
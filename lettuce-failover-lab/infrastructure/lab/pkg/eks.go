@@ -1,39 +1,224 @@
 package pkg
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	awseks "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/eks"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
 	"github.com/pulumi/pulumi-eks/sdk/v2/go/eks"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// eksDesiredNodeCount is the default node group size; pods that require distinct
+// nodes cannot scale past it
+const eksDesiredNodeCount = 3
+
+// eksInstanceType is the Graviton3 instance type of the default node group
+const eksInstanceType = "m7g.large"
+
 type EKSResult struct {
 	ClusterName     pulumi.StringOutput
 	ClusterEndpoint pulumi.StringOutput
 	Kubeconfig      pulumi.AnyOutput
+	NodeRoleName    pulumi.StringOutput
+	// Security groups pulumi-eks creates for the control plane and the worker nodes
+	ClusterSecurityGroupId pulumi.StringOutput
+	NodeSecurityGroupId    pulumi.StringOutput
+	// AuthenticationMode is API when access entries or a CI role are configured, else
+	// CONFIG_MAP
+	AuthenticationMode string
+	// Cluster is the pulumi-eks component
+	Cluster pulumi.Resource
+	// NodeGroup provides the worker nodes, so dependents can wait for them: the
+	// cluster component (self-managed default node group) or the managed node group
+	NodeGroup     pulumi.Resource
+	NodeGroupType string
+	// ADOT add-on version and collector IRSA role, set when cfg.Adot is true
+	AdotAddonVersion     pulumi.StringOutput
+	AdotCollectorRoleArn pulumi.StringOutput
+	// AppMetricsRoleArn is the app's IRSA role, set when cfg.AppMetricsRole is true
+	AppMetricsRoleArn pulumi.StringOutput
+	// CiAccessEntryArn is the CI role's access entry, set when cfg.CiRoleArn is set
+	CiAccessEntryArn pulumi.StringOutput
+}
+
+// AccessEntry grants an IAM principal cluster-wide access through an EKS access entry
+// Access is "admin" or "view"
+type AccessEntry struct {
+	PrincipalArn string `json:"principalArn"`
+	Access       string `json:"access"`
+}
+
+// Inline IAM policy documents, checked by validatePolicyDocument before any resource
+// is created so a JSON typo fails the preview instead of the deploy
+const eksClusterAssumeRolePolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Effect": "Allow",
+		"Principal": {
+			"Service": "eks.amazonaws.com"
+		},
+		"Action": "sts:AssumeRole"
+	}]
+}`
+
+const eksNodeAssumeRolePolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Effect": "Allow",
+		"Principal": {
+			"Service": "ec2.amazonaws.com"
+		},
+		"Action": "sts:AssumeRole"
+	}]
+}`
+
+// elasticacheTestingPolicy lets the app and failover tooling on the nodes trigger
+// failovers, describe the cluster, read the maintenance-mode flag and publish metrics
+// and logs. The ElastiCache statement is limited to elasticacheResources; CloudWatch
+// and logs stay on "*"
+func elasticacheTestingPolicy(elasticacheResources []string) (string, error) {
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect": "Allow",
+				"Action": []string{
+					"elasticache:TestFailover",
+					"elasticache:DescribeReplicationGroups",
+					"elasticache:DescribeCacheClusters",
+					"elasticache:DescribeCacheSubnetGroups",
+				},
+				"Resource": elasticacheResources,
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   "ssm:GetParameter",
+				"Resource": "arn:*:ssm:*:*:parameter" + maintenanceModeParameterName,
+			},
+			{
+				"Effect": "Allow",
+				"Action": []string{
+					"cloudwatch:PutMetricData",
+					"cloudwatch:GetMetricData",
+					"cloudwatch:ListMetrics",
+				},
+				"Resource": "*",
+			},
+			{
+				"Effect": "Allow",
+				"Action": []string{
+					"logs:CreateLogGroup",
+					"logs:CreateLogStream",
+					"logs:PutLogEvents",
+					"logs:DescribeLogGroups",
+					"logs:DescribeLogStreams",
+				},
+				"Resource": "*",
+			},
+		},
+	})
+	return string(policy), err
 }
 
+// labElasticacheArns returns the ARNs of every lab replication group, its nodes and
+// subnet group when cfg.ScopeElasticachePolicy is set, otherwise "*". The names are
+// fixed by clusterResourcePrefix, so the ARNs are known before the clusters exist
+func labElasticacheArns(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig) ([]string, error) {
+	if !cfg.ScopeElasticachePolicy {
+		return []string{"*"}, nil
+	}
+	partition, err := aws.GetPartition(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	region, err := aws.GetRegion(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	identity, err := aws.GetCallerIdentity(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	arnPrefix := fmt.Sprintf("arn:%s:elasticache:%s:%s", partition.Partition, region.Name, identity.AccountId)
+	var arns []string
+	for _, cluster := range cfg.Clusters {
+		prefix := clusterResourcePrefix(cluster.Key)
+		arns = append(arns,
+			fmt.Sprintf("%s:replicationgroup:%s", arnPrefix, prefix),
+			fmt.Sprintf("%s:cluster:%s-*", arnPrefix, prefix),
+		)
+		if cfg.ExistingSubnetGroupName == "" {
+			arns = append(arns, fmt.Sprintf("%s:subnetgroup:%s-subnet-group", arnPrefix, prefix))
+		}
+	}
+	if cfg.ExistingSubnetGroupName != "" {
+		arns = append(arns, fmt.Sprintf("%s:subnetgroup:%s", arnPrefix, cfg.ExistingSubnetGroupName))
+	}
+	return arns, nil
+}
+
+// accessPolicyArns maps AccessEntry.Access to the EKS managed access policy
+var accessPolicyArns = map[string]string{
+	"admin": "arn:aws:eks::aws:cluster-access-policy/AmazonEKSClusterAdminPolicy",
+	"view":  "arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy",
+}
+
+// ciAccessPolicyArn lets the CI role apply the lab's manifests and run smoke test
+// Jobs in any namespace, without the RBAC and cluster-scoped rights of admin
+const ciAccessPolicyArn = "arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy"
+
 // CreateEKSCluster creates an EKS cluster with managed node groups across 3 AZs
-// eksSecurityGroupId is passed from the network stack but not directly used here
+// cfg.EksSecurityGroupId is passed from the network stack but not directly used here
 // (EKS component creates its own security groups)
-func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eksSecurityGroupId string) (*EKSResult, error) {
+// cfg.EksAzCount limits the cluster to the first N distinct-AZ subnets (0 uses all subnets)
+// cfg.EksClusterName, when set, names the cluster instead of a generated name with a
+// random suffix
+// cfg.AccessEntries switches the cluster to API authentication with one access entry each
+// cfg.EksPublicAccessCidrs restricts who can reach the public API endpoint
+// cfg.BottlerocketSettingsToml is appended to the nodes' Bottlerocket user data
+// cfg.ScopeElasticachePolicy limits the nodes' ElastiCache actions to the lab clusters
+// cfg.Adot installs the ADOT add-on with an IRSA role for its collector
+// cfg.AppMetricsRole adds an IRSA role for the app, limited to its metrics namespace
+// cfg.NodeGroupType selects the pulumi-eks self-managed node group or an EKS managed one
+func CreateEKSCluster(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig) (*EKSResult, error) {
+	elasticacheArns, err := labElasticacheArns(ctx, awsProvider, cfg)
+	if err != nil {
+		return nil, err
+	}
+	elasticachePolicyDocument, err := elasticacheTestingPolicy(elasticacheArns)
+	if err != nil {
+		return nil, err
+	}
+	for name, policy := range map[string]string{
+		"EKS cluster assume-role policy": eksClusterAssumeRolePolicy,
+		"EKS node assume-role policy":    eksNodeAssumeRolePolicy,
+		"ElastiCache testing policy":     elasticachePolicyDocument,
+	} {
+		if err := validatePolicyDocument(name, policy); err != nil {
+			return nil, err
+		}
+	}
+
+	// Narrow the subnet set to the requested AZ footprint
+	subnetIds, err := selectSubnetsByAz(ctx, awsProvider, cfg.EksSubnetIds, cfg.EksAzCount)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create IAM role for EKS cluster
 	clusterRole, err := iam.NewRole(ctx, "redis-failover-lab-eks-cluster-role", &iam.RoleArgs{
-		AssumeRolePolicy: pulumi.String(`{
-			"Version": "2012-10-17",
-			"Statement": [{
-				"Effect": "Allow",
-				"Principal": {
-					"Service": "eks.amazonaws.com"
-				},
-				"Action": "sts:AssumeRole"
-			}]
-		}`),
+		AssumeRolePolicy: pulumi.String(eksClusterAssumeRolePolicy),
 		Tags: pulumi.StringMap{
 			"Name": pulumi.String("redis-failover-lab-eks-cluster-role"),
 		},
-	})
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
@@ -42,27 +227,18 @@ func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eks
 	_, err = iam.NewRolePolicyAttachment(ctx, "eks-cluster-policy", &iam.RolePolicyAttachmentArgs{
 		Role:      clusterRole.Name,
 		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/AmazonEKSClusterPolicy"),
-	})
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
 
 	// Create IAM role for worker nodes
 	nodeRole, err := iam.NewRole(ctx, "redis-failover-lab-eks-node-role", &iam.RoleArgs{
-		AssumeRolePolicy: pulumi.String(`{
-			"Version": "2012-10-17",
-			"Statement": [{
-				"Effect": "Allow",
-				"Principal": {
-					"Service": "ec2.amazonaws.com"
-				},
-				"Action": "sts:AssumeRole"
-			}]
-		}`),
+		AssumeRolePolicy: pulumi.String(eksNodeAssumeRolePolicy),
 		Tags: pulumi.StringMap{
 			"Name": pulumi.String("redis-failover-lab-eks-node-role"),
 		},
-	})
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +254,7 @@ func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eks
 		_, err = iam.NewRolePolicyAttachment(ctx, "eks-node-policy-"+string(rune('0'+i)), &iam.RolePolicyAttachmentArgs{
 			Role:      nodeRole.Name,
 			PolicyArn: pulumi.String(policyArn),
-		})
+		}, pulumi.Provider(awsProvider))
 		if err != nil {
 			return nil, err
 		}
@@ -87,42 +263,8 @@ func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eks
 	// Create custom policy for ElastiCache failover testing
 	elasticachePolicy, err := iam.NewPolicy(ctx, "redis-failover-lab-elasticache-policy", &iam.PolicyArgs{
 		Description: pulumi.String("Policy for ElastiCache failover testing"),
-		Policy: pulumi.String(`{
-			"Version": "2012-10-17",
-			"Statement": [
-				{
-					"Effect": "Allow",
-					"Action": [
-						"elasticache:TestFailover",
-						"elasticache:DescribeReplicationGroups",
-						"elasticache:DescribeCacheClusters",
-						"elasticache:DescribeCacheSubnetGroups"
-					],
-					"Resource": "*"
-				},
-				{
-					"Effect": "Allow",
-					"Action": [
-						"cloudwatch:PutMetricData",
-						"cloudwatch:GetMetricData",
-						"cloudwatch:ListMetrics"
-					],
-					"Resource": "*"
-				},
-				{
-					"Effect": "Allow",
-					"Action": [
-						"logs:CreateLogGroup",
-						"logs:CreateLogStream",
-						"logs:PutLogEvents",
-						"logs:DescribeLogGroups",
-						"logs:DescribeLogStreams"
-					],
-					"Resource": "*"
-				}
-			]
-		}`),
-	})
+		Policy:      pulumi.String(elasticachePolicyDocument),
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +272,7 @@ func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eks
 	_, err = iam.NewRolePolicyAttachment(ctx, "eks-node-elasticache-policy", &iam.RolePolicyAttachmentArgs{
 		Role:      nodeRole.Name,
 		PolicyArn: elasticachePolicy.Arn,
-	})
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
@@ -138,41 +280,429 @@ func CreateEKSCluster(ctx *pulumi.Context, vpcId string, subnetIds []string, eks
 	// Create instance profile for nodes
 	instanceProfile, err := iam.NewInstanceProfile(ctx, "redis-failover-lab-eks-instance-profile", &iam.InstanceProfileArgs{
 		Role: nodeRole.Name,
-	})
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
 
+	// Access entries replace the aws-auth ConfigMap when configured
+	authenticationMode := eks.AuthenticationModeConfigMap
+	if len(cfg.AccessEntries) > 0 || cfg.CiRoleArn != "" {
+		authenticationMode = eks.AuthenticationModeApi
+	}
+
+	// Restrict the public API endpoint when CIDRs are configured (validated in ValidateConfig)
+	var publicAccessCidrs pulumi.StringArrayInput
+	if len(cfg.EksPublicAccessCidrs) > 0 {
+		publicAccessCidrs = pulumi.ToStringArray(cfg.EksPublicAccessCidrs)
+	}
+
+	// Extra Bottlerocket settings (kernel tuning, max pods) for connection-heavy nodes
+	var nodeUserData pulumi.StringPtrInput
+	if cfg.BottlerocketSettingsToml != "" {
+		nodeUserData = pulumi.String(cfg.BottlerocketSettingsToml)
+	}
+
+	// Unset keeps the generated name, unique per stack
+	var clusterName pulumi.StringPtrInput
+	if cfg.EksClusterName != "" {
+		clusterName = pulumi.String(cfg.EksClusterName)
+	}
+
 	// Create EKS cluster using pulumi-eks component
 	// Using Graviton3 (ARM64) with Bottlerocket OS for better price/performance
 	// Kubernetes 1.32 - most mature version in standard support
-	cluster, err := eks.NewCluster(ctx, "redis-failover-lab-eks", &eks.ClusterArgs{
-		VpcId:                        pulumi.String(vpcId),
+	clusterArgs := &eks.ClusterArgs{
+		Name:                         clusterName,
+		VpcId:                        pulumi.String(cfg.VpcId),
 		SubnetIds:                    pulumi.ToStringArray(subnetIds),
 		Version:                      pulumi.String("1.32"),
-		InstanceType:                 pulumi.String("m7g.large"),
+		InstanceType:                 pulumi.String(eksInstanceType),
 		OperatingSystem:              eks.OperatingSystemBottlerocket,
-		DesiredCapacity:              pulumi.Int(3),
-		MinSize:                      pulumi.Int(3),
+		DesiredCapacity:              pulumi.Int(eksDesiredNodeCount),
+		MinSize:                      pulumi.Int(eksDesiredNodeCount),
 		MaxSize:                      pulumi.Int(5),
 		NodeAssociatePublicIpAddress: pulumi.BoolRef(false),
 		InstanceProfileName:          instanceProfile.Name,
 		ServiceRole:                  clusterRole,
 		CreateOidcProvider:           pulumi.Bool(true),
+		AuthenticationMode:           &authenticationMode,
+		PublicAccessCidrs:            publicAccessCidrs,
+		NodeUserData:                 nodeUserData,
 		Tags: pulumi.StringMap{
 			"Name":        pulumi.String("redis-failover-lab-eks"),
 			"Environment": pulumi.String("testing"),
 		},
+	}
+	// A managed node group replaces the default one. With the aws-auth ConfigMap
+	// pulumi-eks maps its role only when listed in the cluster's instance roles
+	if cfg.NodeGroupType == "managed" {
+		clusterArgs.SkipDefaultNodeGroup = pulumi.BoolRef(true)
+		clusterArgs.InstanceProfileName = nil
+		if authenticationMode == eks.AuthenticationModeConfigMap {
+			clusterArgs.InstanceRoles = iam.RoleArray{nodeRole}
+		}
+	}
+	clusterOpts := []pulumi.ResourceOption{pulumi.Providers(awsProvider)}
+	if version := cfg.ProviderVersion["eks"]; version != "" {
+		clusterOpts = append(clusterOpts, pulumi.Version(version))
+	}
+	cluster, err := eks.NewCluster(ctx, "redis-failover-lab-eks", clusterArgs, clusterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// EKS creates the access entry of a managed node group's role itself
+	if authenticationMode == eks.AuthenticationModeApi {
+		if err := createAccessEntries(ctx, awsProvider, cluster.EksCluster.Name(), nodeRole.Arn, cfg.NodeGroupType != "managed", cfg.AccessEntries); err != nil {
+			return nil, err
+		}
+	}
+	var ciAccessEntryArn pulumi.StringOutput
+	if cfg.CiRoleArn != "" {
+		ciAccessEntryArn, err = createCiAccessEntry(ctx, awsProvider, cluster.EksCluster.Name(), cfg.CiRoleArn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// pulumi-eks exposes its security groups as resources; callers only need the IDs
+	clusterSecurityGroupId := cluster.ClusterSecurityGroup.ApplyT(func(sg *ec2.SecurityGroup) pulumi.StringOutput {
+		return sg.ID().ToStringOutput()
+	}).(pulumi.StringOutput)
+	nodeSecurityGroupId := cluster.NodeSecurityGroup.ApplyT(func(sg *ec2.SecurityGroup) pulumi.StringOutput {
+		return sg.ID().ToStringOutput()
+	}).(pulumi.StringOutput)
+
+	result := &EKSResult{
+		ClusterName:            cluster.EksCluster.Name(),
+		ClusterEndpoint:        cluster.EksCluster.Endpoint(),
+		Kubeconfig:             cluster.Kubeconfig,
+		NodeRoleName:           nodeRole.Name,
+		ClusterSecurityGroupId: clusterSecurityGroupId,
+		NodeSecurityGroupId:    nodeSecurityGroupId,
+		AuthenticationMode:     string(authenticationMode),
+		Cluster:                cluster,
+		NodeGroup:              cluster,
+		NodeGroupType:          cfg.NodeGroupType,
+		CiAccessEntryArn:       ciAccessEntryArn,
+	}
+	if cfg.NodeGroupType == "managed" {
+		nodeGroup, err := createManagedNodeGroup(ctx, awsProvider, cfg, cluster, nodeRole, subnetIds, nodeSecurityGroupId)
+		if err != nil {
+			return nil, err
+		}
+		result.NodeGroup = nodeGroup
+	}
+	if cfg.Adot {
+		if err := createAdotAddon(ctx, awsProvider, cluster, result); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AppMetricsRole {
+		if err := createAppMetricsRole(ctx, awsProvider, cluster, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// adotCollectorServiceAccount is the service account an OpenTelemetryCollector must
+// run as to assume the ADOT collector role
+const adotCollectorServiceAccount = "system:serviceaccount:opentelemetry-operator-system:adot-collector"
+
+// createAdotAddon installs the ADOT managed add-on, after the cert-manager add-on it
+// requires, and an IRSA role with CloudWatch and X-Ray write for the collector
+func createAdotAddon(ctx *pulumi.Context, awsProvider *aws.Provider, cluster *eks.Cluster, result *EKSResult) error {
+	trustPolicy, err := irsaTrustPolicy(ctx, awsProvider, cluster, []string{adotCollectorServiceAccount})
+	if err != nil {
+		return err
+	}
+
+	collectorRole, err := iam.NewRole(ctx, "redis-failover-lab-adot-collector-role", &iam.RoleArgs{
+		AssumeRolePolicy: trustPolicy,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-adot-collector-role"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{cluster}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	for name, policyArn := range map[string]string{
+		"cloudwatch": "arn:aws:iam::aws:policy/CloudWatchAgentServerPolicy",
+		"xray":       "arn:aws:iam::aws:policy/AWSXrayWriteOnlyAccess",
+	} {
+		_, err = iam.NewRolePolicyAttachment(ctx, "redis-failover-lab-adot-collector-"+name, &iam.RolePolicyAttachmentArgs{
+			Role:      collectorRole.Name,
+			PolicyArn: pulumi.String(policyArn),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The ADOT operator's admission webhooks need certificates from cert-manager
+	certManager, err := awseks.NewAddon(ctx, "redis-failover-lab-cert-manager", &awseks.AddonArgs{
+		ClusterName: cluster.EksCluster.Name(),
+		AddonName:   pulumi.String("cert-manager"),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-cert-manager"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{cluster}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	adot, err := awseks.NewAddon(ctx, "redis-failover-lab-adot", &awseks.AddonArgs{
+		ClusterName: cluster.EksCluster.Name(),
+		AddonName:   pulumi.String("adot"),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-adot"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{certManager}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	result.AdotAddonVersion = adot.AddonVersion
+	result.AdotCollectorRoleArn = collectorRole.Arn
+	return nil
+}
+
+// irsaTrustPolicy lets the service accounts (system:serviceaccount:<namespace>:<name>)
+// assume a role through the cluster's OIDC provider, which pulumi-eks creates
+func irsaTrustPolicy(ctx *pulumi.Context, awsProvider *aws.Provider, cluster *eks.Cluster, serviceAccounts []string) (pulumi.StringOutput, error) {
+	partition, err := aws.GetPartition(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	identity, err := aws.GetCallerIdentity(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// A single subject stays a string, as IAM stores it
+	var subjects interface{} = serviceAccounts
+	if len(serviceAccounts) == 1 {
+		subjects = serviceAccounts[0]
+	}
+	issuer := cluster.EksCluster.Identities().Index(pulumi.Int(0)).Oidcs().Index(pulumi.Int(0)).Issuer().Elem()
+	return issuer.ApplyT(func(issuer string) (string, error) {
+		provider := strings.TrimPrefix(issuer, "https://")
+		bytes, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect": "Allow",
+					"Principal": map[string]string{
+						"Federated": fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", partition.Partition, identity.AccountId, provider),
+					},
+					"Action": "sts:AssumeRoleWithWebIdentity",
+					"Condition": map[string]interface{}{
+						"StringEquals": map[string]interface{}{
+							provider + ":sub": subjects,
+							provider + ":aud": "sts.amazonaws.com",
+						},
+					},
+				},
+			},
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput), nil
+}
+
+// labMetricsNamespace is the CloudWatch namespace of the app's and observer's metrics
+const labMetricsNamespace = "RedisFailoverLab"
+
+// appMetricsServiceAccounts are the service accounts of the stack-deployed app and of
+// the kubectl-applied k8s/deployments, which may assume the app metrics role
+var appMetricsServiceAccounts = []string{
+	"system:serviceaccount:" + appNamespace + ":" + appServiceAccountName,
+	"system:serviceaccount:redis-failover-lab:redis-failover-lab-sa",
+}
+
+// createAppMetricsRole creates an IRSA role for the app that may only publish
+// metrics to labMetricsNamespace, unlike the node role's PutMetricData on any
+// namespace, which stays for the other workloads on the nodes, and read the
+// maintenance-mode flag
+func createAppMetricsRole(ctx *pulumi.Context, awsProvider *aws.Provider, cluster *eks.Cluster, result *EKSResult) error {
+	trustPolicy, err := irsaTrustPolicy(ctx, awsProvider, cluster, appMetricsServiceAccounts)
+	if err != nil {
+		return err
+	}
+	metricsPolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   "cloudwatch:PutMetricData",
+				"Resource": "*",
+				"Condition": map[string]interface{}{
+					"StringEquals": map[string]string{"cloudwatch:namespace": labMetricsNamespace},
+				},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   "ssm:GetParameter",
+				"Resource": "arn:*:ssm:*:*:parameter" + maintenanceModeParameterName,
+			},
+		},
 	})
+	if err != nil {
+		return err
+	}
+	if err := validatePolicyDocument("app metrics policy", string(metricsPolicy)); err != nil {
+		return err
+	}
+
+	role, err := iam.NewRole(ctx, "redis-failover-lab-app-metrics-role", &iam.RoleArgs{
+		AssumeRolePolicy: trustPolicy,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-app-metrics-role"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{cluster}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	_, err = iam.NewRolePolicy(ctx, "redis-failover-lab-app-metrics-policy", &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: pulumi.String(string(metricsPolicy)),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	result.AppMetricsRoleArn = role.Arn
+	return nil
+}
+
+// createManagedNodeGroup creates an EKS managed Bottlerocket node group of the
+// default size. Its launch template attaches the pulumi-eks node security group
+// alongside the EKS cluster security group, as the self-managed nodes have, and
+// carries cfg.BottlerocketSettingsToml, which EKS merges into the node settings
+func createManagedNodeGroup(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, cluster *eks.Cluster, nodeRole *iam.Role, subnetIds []string, nodeSecurityGroupId pulumi.StringOutput) (*eks.ManagedNodeGroup, error) {
+	var userData pulumi.StringPtrInput
+	if cfg.BottlerocketSettingsToml != "" {
+		userData = pulumi.String(base64.StdEncoding.EncodeToString([]byte(cfg.BottlerocketSettingsToml)))
+	}
+	launchTemplate, err := ec2.NewLaunchTemplate(ctx, "redis-failover-lab-eks-managed-nodes", &ec2.LaunchTemplateArgs{
+		Description: pulumi.String("Failover Lab EKS managed node group"),
+		VpcSecurityGroupIds: pulumi.StringArray{
+			nodeSecurityGroupId,
+			cluster.EksCluster.VpcConfig().ClusterSecurityGroupId().Elem(),
+		},
+		UserData: userData,
+		MetadataOptions: &ec2.LaunchTemplateMetadataOptionsArgs{
+			HttpTokens:              pulumi.String("required"),
+			HttpPutResponseHopLimit: pulumi.Int(2),
+		},
+		TagSpecifications: ec2.LaunchTemplateTagSpecificationArray{
+			&ec2.LaunchTemplateTagSpecificationArgs{
+				ResourceType: pulumi.String("instance"),
+				Tags: pulumi.StringMap{
+					"Name":        pulumi.String("redis-failover-lab-eks-managed-node"),
+					"Environment": pulumi.String("testing"),
+				},
+			},
+		},
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
 
-	return &EKSResult{
-		ClusterName:     cluster.EksCluster.Name(),
-		ClusterEndpoint: cluster.EksCluster.Endpoint(),
-		Kubeconfig:      cluster.Kubeconfig,
-	}, nil
+	return eks.NewManagedNodeGroup(ctx, "redis-failover-lab-eks-managed-nodes", &eks.ManagedNodeGroupArgs{
+		Cluster:       cluster,
+		NodeRole:      nodeRole,
+		AmiType:       pulumi.String("BOTTLEROCKET_ARM_64"),
+		InstanceTypes: pulumi.StringArray{pulumi.String(eksInstanceType)},
+		SubnetIds:     pulumi.ToStringArray(subnetIds),
+		ScalingConfig: &awseks.NodeGroupScalingConfigArgs{
+			DesiredSize: pulumi.Int(eksDesiredNodeCount),
+			MinSize:     pulumi.Int(eksDesiredNodeCount),
+			MaxSize:     pulumi.Int(5),
+		},
+		LaunchTemplate: &awseks.NodeGroupLaunchTemplateArgs{
+			Id:      launchTemplate.ID(),
+			Version: pulumi.Sprintf("%d", launchTemplate.LatestVersion),
+		},
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-eks-managed-nodes"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Providers(awsProvider))
+}
+
+// createAccessEntries creates an access entry per principal with its access policy
+// associated cluster-wide. Without the aws-auth ConfigMap the worker node role
+// also needs its own EC2_LINUX entry to join the cluster, unless EKS creates it for
+// a managed node group (nodeAccess false)
+func createAccessEntries(ctx *pulumi.Context, awsProvider *aws.Provider, clusterName pulumi.StringOutput, nodeRoleArn pulumi.StringOutput, nodeAccess bool, entries []AccessEntry) error {
+	if nodeAccess {
+		_, err := awseks.NewAccessEntry(ctx, "redis-failover-lab-eks-node-access", &awseks.AccessEntryArgs{
+			ClusterName:  clusterName,
+			PrincipalArn: nodeRoleArn,
+			Type:         pulumi.String("EC2_LINUX"),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, entry := range entries {
+		name := fmt.Sprintf("redis-failover-lab-eks-access-%d", i)
+		accessEntry, err := awseks.NewAccessEntry(ctx, name, &awseks.AccessEntryArgs{
+			ClusterName:  clusterName,
+			PrincipalArn: pulumi.String(entry.PrincipalArn),
+			Type:         pulumi.String("STANDARD"),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return err
+		}
+
+		_, err = awseks.NewAccessPolicyAssociation(ctx, name, &awseks.AccessPolicyAssociationArgs{
+			ClusterName:  clusterName,
+			PrincipalArn: accessEntry.PrincipalArn,
+			PolicyArn:    pulumi.String(accessPolicyArns[entry.Access]),
+			AccessScope: &awseks.AccessPolicyAssociationAccessScopeArgs{
+				Type: pulumi.String("cluster"),
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createCiAccessEntry gives the CI role, which runs the post-deploy tests but did
+// not create the cluster, an access entry with ciAccessPolicyArn cluster-wide
+// Returns the access entry ARN
+func createCiAccessEntry(ctx *pulumi.Context, awsProvider *aws.Provider, clusterName pulumi.StringOutput, ciRoleArn string) (pulumi.StringOutput, error) {
+	accessEntry, err := awseks.NewAccessEntry(ctx, "redis-failover-lab-eks-ci-access", &awseks.AccessEntryArgs{
+		ClusterName:  clusterName,
+		PrincipalArn: pulumi.String(ciRoleArn),
+		Type:         pulumi.String("STANDARD"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// The association waits for the entry, so the ARN resolves once access is usable
+	association, err := awseks.NewAccessPolicyAssociation(ctx, "redis-failover-lab-eks-ci-access", &awseks.AccessPolicyAssociationArgs{
+		ClusterName:  clusterName,
+		PrincipalArn: accessEntry.PrincipalArn,
+		PolicyArn:    pulumi.String(ciAccessPolicyArn),
+		AccessScope: &awseks.AccessPolicyAssociationAccessScopeArgs{
+			Type: pulumi.String("cluster"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	return pulumi.All(accessEntry.AccessEntryArn, association.ID()).ApplyT(func(args []interface{}) string {
+		return args[0].(string)
+	}).(pulumi.StringOutput), nil
 }
 
 // Helper to create JSON assume role policy
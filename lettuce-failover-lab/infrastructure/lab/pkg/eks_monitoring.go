@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/eks"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type EksMonitoringResult struct {
+	AlarmArns pulumi.StringArray
+}
+
+// eksAlarm describes a Container Insights alarm on cluster-level node or pod health
+type eksAlarm struct {
+	name        string
+	description string
+	metricName  string
+	statistic   string
+	threshold   float64
+	namespace   string // Kubernetes namespace to aggregate pods over, empty for cluster-wide metrics
+}
+
+var eksAlarms = []eksAlarm{
+	{
+		name:        "node-cpu-high",
+		description: "EKS node CPU above 80% - results may reflect node pressure, not failover",
+		metricName:  "node_cpu_utilization",
+		statistic:   "Maximum",
+		threshold:   80,
+	},
+	{
+		name:        "node-memory-high",
+		description: "EKS node memory above 80% - results may reflect node pressure, not failover",
+		metricName:  "node_memory_utilization",
+		statistic:   "Maximum",
+		threshold:   80,
+	},
+	{
+		name:        "node-failed",
+		description: "EKS cluster has failed nodes",
+		metricName:  "cluster_failed_node_count",
+		statistic:   "Maximum",
+		threshold:   0,
+	},
+	{
+		name:        "pod-restarts",
+		description: "Lab pods are restarting - crash loops invalidate failover measurements",
+		metricName:  "pod_number_of_container_restarts",
+		statistic:   "Sum",
+		threshold:   0,
+		namespace:   "redis-failover-lab",
+	},
+}
+
+// CreateEksMonitoring enables Container Insights on the cluster and creates alarms on
+// node CPU/memory, failed nodes and lab pod restarts, notifying alarmTopicArn
+func CreateEksMonitoring(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, clusterName pulumi.StringOutput, nodeRoleName pulumi.StringOutput, alarmTopicArn pulumi.StringOutput) (*EksMonitoringResult, error) {
+	// The CloudWatch agent runs on the nodes and publishes with the node role
+	agentPolicy, err := iam.NewRolePolicyAttachment(ctx, "eks-node-cloudwatch-agent-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      nodeRoleName,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/CloudWatchAgentServerPolicy"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Enable Container Insights via the CloudWatch observability add-on
+	_, err = eks.NewAddon(ctx, "redis-failover-lab-container-insights", &eks.AddonArgs{
+		ClusterName: clusterName,
+		AddonName:   pulumi.String("amazon-cloudwatch-observability"),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-container-insights"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{agentPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	var alarmArns pulumi.StringArray
+	for _, a := range eksAlarms {
+		alarmName := cfg.alarmName("eks-"+a.name, 0)
+		args := &cloudwatch.MetricAlarmArgs{
+			Name:               pulumi.String(alarmName),
+			AlarmDescription:   pulumi.String(a.description),
+			EvaluationPeriods:  pulumi.Int(3),
+			Threshold:          pulumi.Float64(a.threshold),
+			ComparisonOperator: pulumi.String("GreaterThanThreshold"),
+			TreatMissingData:   pulumi.String("notBreaching"),
+			AlarmActions:       pulumi.Array{alarmTopicArn},
+			OkActions:          pulumi.Array{alarmTopicArn},
+			Tags:               alarmTags(ctx, alarmName),
+		}
+		if a.namespace == "" {
+			args.Namespace = pulumi.String("ContainerInsights")
+			args.MetricName = pulumi.String(a.metricName)
+			args.Dimensions = pulumi.StringMap{"ClusterName": clusterName}
+			args.Statistic = pulumi.String(a.statistic)
+			args.Period = pulumi.Int(60)
+		} else {
+			// Pod metrics are only published per pod, so a Metrics Insights query
+			// aggregates them over every pod in the namespace
+			args.MetricQueries = cloudwatch.MetricAlarmMetricQueryArray{
+				&cloudwatch.MetricAlarmMetricQueryArgs{
+					Id:         pulumi.String("pods"),
+					Expression: podMetricsQuery(clusterName, a.metricName, a.statistic, a.namespace),
+					Period:     pulumi.Int(60),
+					ReturnData: pulumi.Bool(true),
+				},
+			}
+		}
+
+		alarm, err := cloudwatch.NewMetricAlarm(ctx, "redis-failover-lab-eks-"+a.name, args, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		alarmArns = append(alarmArns, alarm.Arn)
+	}
+
+	return &EksMonitoringResult{
+		AlarmArns: alarmArns,
+	}, nil
+}
+
+// podMetricsQuery returns a Metrics Insights query aggregating a Container Insights
+// pod metric over every pod of namespace, with statistic (e.g. Sum)
+func podMetricsQuery(clusterName pulumi.StringOutput, metricName, statistic, namespace string) pulumi.StringOutput {
+	return clusterName.ApplyT(func(name string) string {
+		return fmt.Sprintf(`SELECT %s(%s) FROM SCHEMA(ContainerInsights, ClusterName, Namespace, PodName) WHERE ClusterName = '%s' AND Namespace = '%s'`,
+			strings.ToUpper(statistic), metricName, name, namespace)
+	}).(pulumi.StringOutput)
+}
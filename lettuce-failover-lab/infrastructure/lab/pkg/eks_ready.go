@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// eksReadySource polls the Auto Scaling groups tagged for the cluster until their
+// desired nodes are InService and Healthy, or the timeout passes. Timing out reports
+// ready false instead of failing, so callers decide what a slow node group means
+const eksReadySource = `import time
+
+import boto3
+
+autoscaling = boto3.client("autoscaling")
+
+
+def node_counts(cluster_name):
+    groups = autoscaling.describe_auto_scaling_groups(
+        Filters=[{"Name": "tag-key", "Values": ["kubernetes.io/cluster/" + cluster_name]}],
+    )["AutoScalingGroups"]
+    desired = sum(group["DesiredCapacity"] for group in groups)
+    in_service = sum(
+        1
+        for group in groups
+        for instance in group["Instances"]
+        if instance["LifecycleState"] == "InService" and instance["HealthStatus"] == "Healthy"
+    )
+    return desired, in_service
+
+
+def handler(event, context):
+    deadline = time.time() + event["timeoutSeconds"]
+    while True:
+        desired, in_service = node_counts(event["clusterName"])
+        ready = desired > 0 and in_service >= desired
+        if ready or time.time() >= deadline:
+            return {"ready": ready, "desiredNodes": desired, "inServiceNodes": in_service}
+        time.sleep(15)
+`
+
+type EksReadyResult struct {
+	// Status is {ready, desiredNodes, inServiceNodes} as of the end of the wait
+	Status pulumi.MapOutput
+}
+
+// WaitForEksNodes waits, once the cluster and its node group exist, until the node
+// group's desired nodes are InService, for up to cfg.EksReadyTimeout seconds. The
+// lab's nodes are a self-managed Auto Scaling group rather than an EKS managed node
+// group, so readiness is read from the group instead of DescribeNodegroup
+func WaitForEksNodes(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, eksResult *EKSResult) (*EksReadyResult, error) {
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, "redis-failover-lab-eks-ready-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-eks-ready-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, "redis-failover-lab-eks-ready-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	describePolicy, err := iam.NewRolePolicy(ctx, "redis-failover-lab-eks-ready-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": ["autoscaling:DescribeAutoScalingGroups"],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, "redis-failover-lab-eks-ready", &lambda.FunctionArgs{
+		Description: pulumi.String("Waits for the Failover Lab EKS nodes to be InService"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		// The wait plus headroom for the last poll
+		Timeout: pulumi.Int(cfg.EksReadyTimeout + 60),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(eksReadySource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-eks-ready"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, describePolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := eksResult.ClusterName.ApplyT(func(name string) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"clusterName":    name,
+			"timeoutSeconds": cfg.EksReadyTimeout,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	// Depending on the pulumi-eks component waits for its node group as well as the
+	// control plane; invoked on create and again only if the cluster or timeout changes
+	invocation, err := lambda.NewInvocation(ctx, "redis-failover-lab-eks-ready", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.DependsOn([]pulumi.Resource{eksResult.NodeGroup}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EksReadyResult{
+		Status: invocation.Result.ApplyT(func(result string) (map[string]interface{}, error) {
+			var status map[string]interface{}
+			err := json.Unmarshal([]byte(result), &status)
+			return status, err
+		}).(pulumi.MapOutput),
+	}, nil
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// awsMocks answers the partition, region and account lookups labElasticacheArns makes
+type awsMocks struct{}
+
+func (awsMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (awsMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "aws:index/getPartition:getPartition":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"partition": "aws", "id": "aws"}), nil
+	case "aws:index/getRegion:getRegion":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"name": "us-east-1", "id": "us-east-1"}), nil
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"accountId": "123456789012", "id": "123456789012"}), nil
+	}
+	return args.Args, nil
+}
+
+// renderElasticacheArns runs labElasticacheArns against awsMocks
+func renderElasticacheArns(t *testing.T, cfg *LabConfig) []string {
+	t.Helper()
+	var arns []string
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		awsProvider, err := aws.NewProvider(ctx, "aws", &aws.ProviderArgs{Region: pulumi.String("us-east-1")})
+		if err != nil {
+			return err
+		}
+		arns, err = labElasticacheArns(ctx, awsProvider, cfg)
+		return err
+	}, pulumi.WithMocks("redis-failover-lab", "test", awsMocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return arns
+}
+
+func TestLabElasticacheArns(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *LabConfig
+		want []string
+	}{
+		{
+			name: "unscoped",
+			cfg:  &LabConfig{Clusters: []ClusterConfig{{Key: defaultClusterKey}}},
+			want: []string{"*"},
+		},
+		{
+			name: "scoped",
+			cfg: &LabConfig{
+				ScopeElasticachePolicy: true,
+				Clusters:               []ClusterConfig{{Key: defaultClusterKey}, {Key: "valkey"}},
+			},
+			want: []string{
+				"arn:aws:elasticache:us-east-1:123456789012:replicationgroup:redis-failover-lab",
+				"arn:aws:elasticache:us-east-1:123456789012:cluster:redis-failover-lab-*",
+				"arn:aws:elasticache:us-east-1:123456789012:subnetgroup:redis-failover-lab-subnet-group",
+				"arn:aws:elasticache:us-east-1:123456789012:replicationgroup:redis-failover-lab-valkey",
+				"arn:aws:elasticache:us-east-1:123456789012:cluster:redis-failover-lab-valkey-*",
+				"arn:aws:elasticache:us-east-1:123456789012:subnetgroup:redis-failover-lab-valkey-subnet-group",
+			},
+		},
+		{
+			name: "scoped with existing subnet group",
+			cfg: &LabConfig{
+				ScopeElasticachePolicy:  true,
+				ExistingSubnetGroupName: "shared-cache-subnets",
+				Clusters:                []ClusterConfig{{Key: defaultClusterKey}},
+			},
+			want: []string{
+				"arn:aws:elasticache:us-east-1:123456789012:replicationgroup:redis-failover-lab",
+				"arn:aws:elasticache:us-east-1:123456789012:cluster:redis-failover-lab-*",
+				"arn:aws:elasticache:us-east-1:123456789012:subnetgroup:shared-cache-subnets",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderElasticacheArns(t, tt.cfg)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("labElasticacheArns() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestElasticacheTestingPolicyScoped(t *testing.T) {
+	arns := renderElasticacheArns(t, &LabConfig{
+		ScopeElasticachePolicy: true,
+		Clusters:               []ClusterConfig{{Key: defaultClusterKey}, {Key: "valkey"}},
+	})
+	policy, err := elasticacheTestingPolicy(arns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePolicyDocument("ElastiCache testing policy", policy); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc policyDocument
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		t.Fatal(err)
+	}
+	elasticacheStatements := 0
+	for i, statement := range doc.Statement {
+		if !strings.Contains(strings.Join(policyStrings(statement.Action), " "), "elasticache:") {
+			continue
+		}
+		elasticacheStatements++
+		resources := policyStrings(statement.Resource)
+		if len(resources) == 0 {
+			t.Errorf("statement %d grants ElastiCache actions on no resources", i)
+		}
+		for _, r := range resources {
+			if r == "*" || !strings.HasPrefix(r, "arn:aws:elasticache:us-east-1:123456789012:") {
+				t.Errorf("statement %d grants ElastiCache actions on %q", i, r)
+			}
+		}
+	}
+	if elasticacheStatements == 0 {
+		t.Error("policy has no ElastiCache statement")
+	}
+}
+
+// policyStrings flattens an Action or Resource, which IAM allows as a string or a list
+func policyStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -1,101 +1,610 @@
 package pkg
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/elasticache"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// ClusterConfig is one entry of the clusters config list
+// Key names the cluster's resources; NodeType defaults to the stack-wide nodeType
+type ClusterConfig struct {
+	Key      string `json:"key"`
+	NodeType string `json:"nodeType"`
+}
+
+// BackupPlanTag is the tag a central backup plan's tag-based selection matches on
+type BackupPlanTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// defaultClusterKey keeps the original single-cluster resource names so existing
+// stacks are not replaced when the clusters list is introduced
+const defaultClusterKey = "default"
+
+// clusterResourcePrefix derives the name prefix for every resource of one cluster
+func clusterResourcePrefix(clusterKey string) string {
+	if clusterKey == defaultClusterKey {
+		return "redis-failover-lab"
+	}
+	return "redis-failover-lab-" + clusterKey
+}
+
 type ElastiCacheResult struct {
-	ConfigurationEndpoint pulumi.StringOutput
-	ReplicationGroupId    pulumi.StringOutput
-}
-
-// CreateElastiCacheCluster creates a 3-shard Redis cluster with 1 replica per shard
-// redisSecurityGroupId is passed from the network stack
-func CreateElastiCacheCluster(ctx *pulumi.Context, subnetIds []string, redisSecurityGroupId string) (*ElastiCacheResult, error) {
-	// Create subnet group for ElastiCache
-	subnetGroup, err := elasticache.NewSubnetGroup(ctx, "redis-failover-lab-subnet-group", &elasticache.SubnetGroupArgs{
-		Name:        pulumi.String("redis-failover-lab-subnet-group"),
-		Description: pulumi.String("Subnet group for Failover Lab Redis cluster"),
-		SubnetIds:   pulumi.ToStringArray(subnetIds),
+	ConfigurationEndpoint    pulumi.StringOutput
+	ReplicationGroupId       pulumi.StringOutput
+	ReplicationGroupArn      pulumi.StringOutput
+	Port                     pulumi.IntOutput
+	TransitEncryptionEnabled pulumi.BoolOutput
+	ClusterEnabled           pulumi.BoolOutput
+	ParameterGroupName       pulumi.StringOutput
+	PrimaryAz                pulumi.StringOutput
+	// PrimaryPlacement maps each shard (0001, 0002, ...) to the AZ of its current
+	// primary, or unknown before IsMaster reports one
+	PrimaryPlacement pulumi.StringMapOutput
+	// ShardPrimaries maps each shard to its current primary's node suffix (0001-002,
+	// ...), by IsMaster; shards with no primary reporting yet are left out
+	ShardPrimaries pulumi.StringMapOutput
+	// ClientConfig is the clientConfig JSON the app configures its connection from
+	ClientConfig pulumi.StringOutput
+	// ConfigDiff compares requested settings with those AWS applied
+	ConfigDiff pulumi.MapOutput
+	// ShardReplicas is the number of replicas in each shard, in shard order
+	ShardReplicas []int
+	// EngineLogGroupName receives the engine log, set when cfg.ConnectionLogging is true
+	EngineLogGroupName pulumi.StringOutput
+	// SlowLogGroupName receives the slow log, set when cfg.SeparateRedisLogGroups is true
+	SlowLogGroupName pulumi.StringOutput
+}
+
+// clientConfig tells the app how to connect: cluster mode picks the Lettuce client
+// AuthSecretArn is null, as the lab cluster has no auth token
+type clientConfig struct {
+	ClusterMode   bool    `json:"clusterMode"`
+	Endpoint      string  `json:"endpoint"`
+	Port          int     `json:"port"`
+	Tls           bool    `json:"tls"`
+	AuthSecretArn *string `json:"authSecretArn"`
+}
+
+// Replication group topology: 3 shards (node groups) with 1 replica per shard,
+// unless shardReplicas sets the replicas of each shard
+const (
+	numShards        = 3
+	replicasPerShard = 1
+)
+
+// nodeSuffixes lists the shard/node suffix (0001-001, ...) of every node, shard by
+// shard, with shardReplicas[i] replicas in shard i+1
+func nodeSuffixes(shardReplicas []int) []string {
+	var suffixes []string
+	for shard, replicas := range shardReplicas {
+		for member := 1; member <= replicas+1; member++ {
+			suffixes = append(suffixes, fmt.Sprintf("%04d-%03d", shard+1, member))
+		}
+	}
+	return suffixes
+}
+
+// withReplicaOverrides returns shardReplicas with the shards keyed in overrides, by
+// number from 1, set to their replica count
+func withReplicaOverrides(shardReplicas []int, overrides map[string]int) ([]int, error) {
+	result := append([]int(nil), shardReplicas...)
+	for shard, replicas := range overrides {
+		index, err := strconv.Atoi(shard)
+		if err != nil || index < 1 || index > len(result) {
+			return nil, fmt.Errorf("replicaOverrides: shard %s out of range, the cluster has %d shards", shard, len(result))
+		}
+		result[index-1] = replicas
+	}
+	return result, nil
+}
+
+// uniformReplicas is the replica count every shard is created with: the smallest of
+// shardReplicas, so shards with more replicas only ever need replicas added
+func uniformReplicas(shardReplicas []int) int {
+	smallest := shardReplicas[0]
+	for _, replicas := range shardReplicas {
+		if replicas < smallest {
+			smallest = replicas
+		}
+	}
+	return smallest
+}
+
+// evenReplicas reports whether every shard has the same number of replicas
+func evenReplicas(shardReplicas []int) bool {
+	for _, replicas := range shardReplicas {
+		if replicas != shardReplicas[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// alternativeNodeTypes is a maintained list of current-generation node types
+// probed for availability when the requested node type is not offered
+var alternativeNodeTypes = []string{
+	"cache.r7g.large",
+	"cache.r6g.large",
+	"cache.m7g.large",
+	"cache.m6g.large",
+	"cache.r5.large",
+	"cache.m5.large",
+	"cache.t4g.medium",
+	"cache.t3.medium",
+}
+
+// nodeTypeOffered reports whether ElastiCache offers the node type in the current region
+// Reserved node offerings are used as a proxy for regional availability
+func nodeTypeOffered(ctx *pulumi.Context, awsProvider *aws.Provider, nodeType string) bool {
+	_, err := elasticache.GetReservedCacheNodeOffering(ctx, &elasticache.GetReservedCacheNodeOfferingArgs{
+		CacheNodeType:      nodeType,
+		Duration:           "P1Y",
+		OfferingType:       "No Upfront",
+		ProductDescription: "redis",
+	}, pulumi.Provider(awsProvider))
+	return err == nil
+}
+
+// High availability settings of every replication group
+const (
+	multiAzEnabled           = true
+	automaticFailoverEnabled = true
+)
+
+// validateHA rejects combinations ElastiCache refuses: Multi-AZ requires automatic
+// failover, which requires at least one replica in every shard to promote
+// replicas is the smallest replica count of any shard
+func validateHA(multiAz, autoFailover bool, replicas int) error {
+	if multiAz && !autoFailover {
+		return fmt.Errorf("multi-AZ requires automatic failover to be enabled")
+	}
+	if autoFailover && replicas < 1 {
+		return fmt.Errorf("automatic failover requires at least 1 replica per shard, but a shard has %d", replicas)
+	}
+	return nil
+}
+
+// validateNodeType returns an error listing available alternatives if nodeType
+// is not offered in the target region
+func validateNodeType(ctx *pulumi.Context, awsProvider *aws.Provider, nodeType string) error {
+	if nodeTypeOffered(ctx, awsProvider, nodeType) {
+		return nil
+	}
+
+	var available []string
+	for _, candidate := range alternativeNodeTypes {
+		if candidate == nodeType {
+			continue
+		}
+		if nodeTypeOffered(ctx, awsProvider, candidate) {
+			available = append(available, candidate)
+		}
+		if len(available) == 3 {
+			break
+		}
+	}
+	if len(available) == 0 {
+		return fmt.Errorf("node type %s is not offered by ElastiCache in this region", nodeType)
+	}
+	return fmt.Errorf("node type %s is not offered by ElastiCache in this region; available alternatives include: %s",
+		nodeType, strings.Join(available, ", "))
+}
+
+// cacheParameters returns the parameter group settings for cluster mode plus the
+// optional lab features that depend on engine parameters and cfg.ParameterOverrides
+func cacheParameters(cfg *LabConfig) elasticache.ParameterGroupParameterArray {
+	parameters := elasticache.ParameterGroupParameterArray{
+		&elasticache.ParameterGroupParameterArgs{
+			Name:  pulumi.String("cluster-enabled"),
+			Value: pulumi.String("yes"),
+		},
+	}
+	// Unset keeps the engine default so existing parameter groups are unchanged
+	if cfg.ClusterNodeTimeout != 0 {
+		parameters = append(parameters, &elasticache.ParameterGroupParameterArgs{
+			Name:  pulumi.String("cluster-node-timeout"),
+			Value: pulumi.String(strconv.Itoa(cfg.ClusterNodeTimeout)),
+		})
+	}
+	// The failover observer subscribes to keyspace events for its heartbeat key (K$)
+	if cfg.DeployFailoverObserver {
+		parameters = append(parameters, &elasticache.ParameterGroupParameterArgs{
+			Name:  pulumi.String("notify-keyspace-events"),
+			Value: pulumi.String("K$"),
+		})
+	}
+	// Overrides are sorted so the parameter list, and its diff, is stable
+	names := make([]string, 0, len(cfg.ParameterOverrides))
+	for name := range cfg.ParameterOverrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parameters = append(parameters, &elasticache.ParameterGroupParameterArgs{
+			Name:  pulumi.String(name),
+			Value: pulumi.String(cfg.ParameterOverrides[name]),
+		})
+	}
+	return parameters
+}
+
+// configDiffEntry is one requested setting and the value AWS applied. Engine versions
+// match when the applied one extends the requested one (7.1 and 7.1.0)
+func configDiffEntry(requested, applied string) map[string]interface{} {
+	matches := applied == requested || strings.HasPrefix(applied, requested+".")
+	return map[string]interface{}{
+		"requested": requested,
+		"applied":   applied,
+		"matches":   matches,
+	}
+}
+
+// redisSecurityGroupIds returns the security groups of every replication group: the
+// network stack's Redis group, then the extra ones in config order
+func redisSecurityGroupIds(cfg *LabConfig) []string {
+	return append([]string{cfg.RedisSecurityGroupId}, cfg.ExtraRedisSecurityGroupIds...)
+}
+
+// replicationGroupOptions returns resource options for the replication group
+// Auto scaling owns the shard and replica counts, so Pulumi must not revert them;
+// with uneven shardReplicas, applyShardReplicas owns the replica counts
+func replicationGroupOptions(cfg *LabConfig, shardReplicas []int) []pulumi.ResourceOption {
+	if cfg.CacheAutoScaling {
+		return []pulumi.ResourceOption{
+			pulumi.IgnoreChanges([]string{"numNodeGroups", "replicasPerNodeGroup"}),
+		}
+	}
+	if !evenReplicas(shardReplicas) {
+		return []pulumi.ResourceOption{
+			pulumi.IgnoreChanges([]string{"replicasPerNodeGroup"}),
+		}
+	}
+	return nil
+}
+
+// redisLogGroupName is the dedicated log group of the cluster's redis-<logType> log
+// with cfg.SeparateRedisLogGroups: /failover-lab/redis-<logType>, with the cluster
+// key as a further path segment for clusters other than the default
+func redisLogGroupName(clusterKey, logType string) string {
+	if clusterKey == defaultClusterKey {
+		return "/failover-lab/redis-" + logType
+	}
+	return "/failover-lab/" + clusterKey + "/redis-" + logType
+}
+
+// createRedisLogGroup creates a log group the replication group delivers a log to,
+// with cfg.LogRetentionDays like the application log group
+func createRedisLogGroup(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, resourceName, name string) (*cloudwatch.LogGroup, error) {
+	return cloudwatch.NewLogGroup(ctx, resourceName, &cloudwatch.LogGroupArgs{
+		Name:            pulumi.String(name),
+		RetentionInDays: pulumi.Int(cfg.LogRetentionDays),
 		Tags: pulumi.StringMap{
-			"Name": pulumi.String("redis-failover-lab-subnet-group"),
+			"Name":        pulumi.String(resourceName),
+			"Environment": pulumi.String("testing"),
 		},
-	})
+	}, pulumi.RetainOnDelete(cfg.RetainLogsOnDestroy), pulumi.Provider(awsProvider))
+}
+
+// CreateElastiCacheCluster creates a 3-shard Redis cluster with cfg.ShardReplicas
+// replicas per shard (1 each by default), and replicaOverrides replicas in the shards
+// it keys by number from 1
+// cfg.RedisSecurityGroupId is passed from the network stack, and attached along with
+// cfg.ExtraRedisSecurityGroupIds
+// dedicated, when non-nil, replaces redisSubnetIds with subnets created by this stack
+// cfg.ExistingSubnetGroupName reuses a centrally managed subnet group instead
+// cfg.LocalZone places the subnet group, and with it every node, in one Local Zone
+// cfg.ExistingParameterGroupName uses a given parameter group as-is, once it is
+// confirmed to enable cluster mode
+// cfg.ConnectionLogging delivers the engine log to a CloudWatch log group
+// cfg.SeparateRedisLogGroups adds the slow log, each log type in its own group
+// All resource names derive from cluster.Key, so it is safe to call once per cluster
+func CreateElastiCacheCluster(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, cluster ClusterConfig, dedicated *ElasticacheSubnetsResult, replicaOverrides map[string]int) (*ElastiCacheResult, error) {
+	prefix := clusterResourcePrefix(cluster.Key)
+	shardReplicas, err := withReplicaOverrides(cfg.ShardReplicas, replicaOverrides)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create parameter group for cluster mode
-	parameterGroup, err := elasticache.NewParameterGroup(ctx, "redis-failover-lab-params", &elasticache.ParameterGroupArgs{
-		Name:        pulumi.String("redis-failover-lab-params"),
-		Family:      pulumi.String("redis7"),
-		Description: pulumi.String("Parameter group for Failover Lab Redis cluster"),
-		Parameters: elasticache.ParameterGroupParameterArray{
-			&elasticache.ParameterGroupParameterArgs{
-				Name:  pulumi.String("cluster-enabled"),
-				Value: pulumi.String("yes"),
-			},
-		},
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String("redis-failover-lab-params"),
-		},
-	})
+	// Confirm the node type is offered before creating anything
+	if err := validateNodeType(ctx, awsProvider, cluster.NodeType); err != nil {
+		return nil, err
+	}
+	engine, err := resolveEngineVersion(cfg.Region, cfg.EngineVersion)
 	if err != nil {
 		return nil, err
 	}
+	if err := validateParameterOverrides(engine.Family, cfg.ParameterOverrides); err != nil {
+		return nil, err
+	}
+	if cfg.ExistingParameterGroupName != "" {
+		if err := validateExistingParameterGroup(cfg.Region, cfg.ExistingParameterGroupName, engine.Family, cfg.DeployFailoverObserver); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LocalZone != "" {
+		if err := validateLocalZone(ctx, awsProvider, cfg.LocalZone, cluster.NodeType); err != nil {
+			return nil, err
+		}
+	}
+	// A Local Zone is a single zone, so there is no other AZ for Multi-AZ; replicas
+	// in the zone are still promoted by automatic failover
+	multiAz := multiAzEnabled && cfg.LocalZone == ""
+	if err := validateHA(multiAz, automaticFailoverEnabled, uniformReplicas(shardReplicas)); err != nil {
+		return nil, err
+	}
+
+	// Dedicated subnets already span the requested AZs; otherwise narrow redisSubnetIds
+	var subnetIds pulumi.StringArray
+	if dedicated != nil {
+		subnetIds = dedicated.SubnetIds
+	} else {
+		// An existing subnet group is used as-is; its subnets are still validated
+		candidates := cfg.RedisSubnetIds
+		if cfg.ExistingSubnetGroupName != "" {
+			existing, err := elasticache.LookupSubnetGroup(ctx, &elasticache.LookupSubnetGroupArgs{
+				Name: cfg.ExistingSubnetGroupName,
+			}, pulumi.Provider(awsProvider))
+			if err != nil {
+				return nil, fmt.Errorf("existingSubnetGroupName %s: %w", cfg.ExistingSubnetGroupName, err)
+			}
+			if err := validateSubnetsMultiAz(ctx, awsProvider, existing.SubnetIds); err != nil {
+				return nil, fmt.Errorf("existingSubnetGroupName %s: %w", cfg.ExistingSubnetGroupName, err)
+			}
+			candidates = existing.SubnetIds
+		}
+		// A Local Zone takes only the candidates in that zone
+		var selected []string
+		if cfg.LocalZone != "" {
+			selected, err = selectSubnetsInZone(ctx, awsProvider, candidates, cfg.LocalZone)
+		} else {
+			selected, err = selectSubnetsInAzs(ctx, awsProvider, candidates, cfg.ElasticacheAzs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := validateSubnetsNetworkType(ctx, awsProvider, selected, cfg.NetworkType); err != nil {
+			return nil, err
+		}
+		subnetIds = pulumi.ToStringArray(selected)
+	}
+	// Every shard is created with the fewest replicas any shard has; uneven shards
+	// get the rest from applyShardReplicas
+	baseReplicas := uniformReplicas(shardReplicas)
+
+	// Snapshot on destroy only when explicitly requested; names must be unique per cluster
+	var finalSnapshotIdentifier pulumi.StringPtrInput
+	if !*cfg.SkipFinalSnapshot {
+		snapshotId := cfg.FinalSnapshotIdentifier
+		if cluster.Key != defaultClusterKey {
+			snapshotId += "-" + cluster.Key
+		}
+		finalSnapshotIdentifier = pulumi.String(snapshotId)
+	}
+
+	// Create subnet group for ElastiCache unless an existing one is reused
+	var subnetGroupName pulumi.StringInput = pulumi.String(cfg.ExistingSubnetGroupName)
+	if cfg.ExistingSubnetGroupName == "" {
+		subnetGroup, err := elasticache.NewSubnetGroup(ctx, prefix+"-subnet-group", &elasticache.SubnetGroupArgs{
+			Name:        pulumi.String(prefix + "-subnet-group"),
+			Description: pulumi.String("Subnet group for Failover Lab Redis cluster"),
+			SubnetIds:   subnetIds,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(prefix + "-subnet-group"),
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		subnetGroupName = subnetGroup.Name
+	}
+
+	// Create parameter group for cluster mode unless an existing one is used
+	parameterGroupName := pulumi.String(cfg.ExistingParameterGroupName).ToStringOutput()
+	if cfg.ExistingParameterGroupName == "" {
+		parameterGroup, err := elasticache.NewParameterGroup(ctx, prefix+"-params", &elasticache.ParameterGroupArgs{
+			Name:        pulumi.String(prefix + "-params"),
+			Family:      pulumi.String(engine.Family),
+			Description: pulumi.String("Parameter group for Failover Lab Redis cluster"),
+			Parameters:  cacheParameters(cfg),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(prefix + "-params"),
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		parameterGroupName = parameterGroup.Name
+	}
+
+	// ElastiCache does not expose loglevel, so the engine log comes at the engine's
+	// default notice level: replication links lost and re-established, syncs,
+	// failovers and cluster state changes, but not each client accept and close
+	// With cfg.SeparateRedisLogGroups the slow log is delivered too, and each log
+	// type goes to a dedicated redisLogGroupName group
+	var logDelivery elasticache.ReplicationGroupLogDeliveryConfigurationArray
+	var engineLogGroupName, slowLogGroupName pulumi.StringOutput
+	if cfg.ConnectionLogging {
+		name := "/redis-failover-lab/" + prefix + "/engine-log"
+		if cfg.SeparateRedisLogGroups {
+			name = redisLogGroupName(cluster.Key, "engine")
+		}
+		engineLogGroup, err := createRedisLogGroup(ctx, awsProvider, cfg, prefix+"-engine-log", name)
+		if err != nil {
+			return nil, err
+		}
+		engineLogGroupName = engineLogGroup.Name
+		logDelivery = append(logDelivery, &elasticache.ReplicationGroupLogDeliveryConfigurationArgs{
+			Destination:     engineLogGroup.Name,
+			DestinationType: pulumi.String("cloudwatch-logs"),
+			LogFormat:       pulumi.String("json"),
+			LogType:         pulumi.String("engine-log"),
+		})
+	}
+	if cfg.SeparateRedisLogGroups {
+		slowLogGroup, err := createRedisLogGroup(ctx, awsProvider, cfg, prefix+"-slow-log", redisLogGroupName(cluster.Key, "slow"))
+		if err != nil {
+			return nil, err
+		}
+		slowLogGroupName = slowLogGroup.Name
+		logDelivery = append(logDelivery, &elasticache.ReplicationGroupLogDeliveryConfigurationArgs{
+			Destination:     slowLogGroup.Name,
+			DestinationType: pulumi.String("cloudwatch-logs"),
+			LogFormat:       pulumi.String("json"),
+			LogType:         pulumi.String("slow-log"),
+		})
+	}
+
+	tags := pulumi.StringMap{
+		"Name":        pulumi.String(prefix + "-redis"),
+		"Environment": pulumi.String("testing"),
+		"Purpose":     pulumi.String("lettuce-failover-testing"),
+	}
+	if cfg.BackupPlanTag != nil {
+		tags[cfg.BackupPlanTag.Key] = pulumi.String(cfg.BackupPlanTag.Value)
+	}
 
 	// Create ElastiCache Redis cluster
-	// 3 shards with 1 replica each = 6 nodes total
-	replicationGroup, err := elasticache.NewReplicationGroup(ctx, "redis-failover-lab-redis", &elasticache.ReplicationGroupArgs{
-		ReplicationGroupId: pulumi.String("redis-failover-lab"),
+	// 3 shards with 1 replica each = 6 nodes total by default
+	replicationGroup, err := elasticache.NewReplicationGroup(ctx, prefix+"-redis", &elasticache.ReplicationGroupArgs{
+		ReplicationGroupId: pulumi.String(prefix),
 		Description:        pulumi.String("Redis cluster for Lettuce failover testing"),
 
 		// Node configuration
-		NodeType:           pulumi.String("cache.r7g.large"),
+		NodeType:           pulumi.String(cluster.NodeType),
 		Engine:             pulumi.String("redis"),
-		EngineVersion:      pulumi.String("7.1"),
-		ParameterGroupName: parameterGroup.Name,
+		EngineVersion:      pulumi.String(engine.Version),
+		ParameterGroupName: parameterGroupName,
 
 		// Cluster mode configuration
-		// 3 shards (node groups) with 1 replica per shard
-		NumNodeGroups:        pulumi.Int(3),
-		ReplicasPerNodeGroup: pulumi.Int(1),
+		// 3 shards (node groups) with the same number of replicas each
+		NumNodeGroups:        pulumi.Int(numShards),
+		ReplicasPerNodeGroup: pulumi.Int(baseReplicas),
 
 		// Network configuration
-		SubnetGroupName: subnetGroup.Name,
-		SecurityGroupIds: pulumi.StringArray{
-			pulumi.String(redisSecurityGroupId),
-		},
+		SubnetGroupName:  subnetGroupName,
+		SecurityGroupIds: pulumi.ToStringArray(redisSecurityGroupIds(cfg)),
+
+		// IP addressing for node endpoints and cluster discovery
+		NetworkType: pulumi.String(cfg.NetworkType),
+		IpDiscovery: pulumi.String(cfg.IpDiscovery),
 
 		// High availability
-		AutomaticFailoverEnabled: pulumi.Bool(true),
-		MultiAzEnabled:           pulumi.Bool(true),
+		AutomaticFailoverEnabled: pulumi.Bool(automaticFailoverEnabled),
+		MultiAzEnabled:           pulumi.Bool(multiAz),
 
 		// Encryption
-		AtRestEncryptionEnabled:  pulumi.Bool(true),
-		TransitEncryptionEnabled: pulumi.Bool(true),
+		AtRestEncryptionEnabled:  pulumi.Bool(*cfg.Encryption),
+		TransitEncryptionEnabled: pulumi.Bool(*cfg.Encryption),
 
 		// Maintenance
 		MaintenanceWindow:      pulumi.String("sun:05:00-sun:06:00"),
 		SnapshotRetentionLimit: pulumi.Int(1),
 		SnapshotWindow:         pulumi.String("04:00-05:00"),
 
-		// Apply changes immediately for testing purposes
-		ApplyImmediately: pulumi.Bool(true),
+		// Engine and slow log delivery, with cfg.ConnectionLogging and
+		// cfg.SeparateRedisLogGroups
+		LogDeliveryConfigurations: logDelivery,
 
-		Tags: pulumi.StringMap{
-			"Name":        pulumi.String("redis-failover-lab-redis"),
-			"Environment": pulumi.String("testing"),
-			"Purpose":     pulumi.String("lettuce-failover-testing"),
-		},
-	})
+		// Destroy-time data retention (no final snapshot unless skipFinalSnapshot is false)
+		FinalSnapshotIdentifier: finalSnapshotIdentifier,
+
+		// Apply changes immediately for testing purposes, unless deferMaintenance
+		// queues them for the maintenance window to keep soak tests undisturbed
+		ApplyImmediately: pulumi.Bool(*cfg.ApplyImmediately),
+
+		Tags: tags,
+	}, append(replicationGroupOptions(cfg, shardReplicas), pulumi.Provider(awsProvider))...)
 	if err != nil {
 		return nil, err
 	}
 
+	// With uneven shards the ID resolves only once the replicas are added, so the
+	// per-node lookups of dependents find every node
+	replicationGroupId := replicationGroup.ReplicationGroupId
+	if !evenReplicas(shardReplicas) {
+		shardReplicasInvocation, err := applyShardReplicas(ctx, awsProvider, prefix, replicationGroupId, shardReplicas)
+		if err != nil {
+			return nil, err
+		}
+		replicationGroupId = pulumi.All(replicationGroupId, shardReplicasInvocation.Result).ApplyT(func(args []interface{}) string {
+			return args[0].(string)
+		}).(pulumi.StringOutput)
+	}
+
+	// Primaries are resolved from IsMaster on every update, so placement follows
+	// failovers; shards not reporting yet, as right after creation, are unknown
+	shardPrimaries := replicationGroupId.ApplyT(func(id string) (map[string]string, error) {
+		return lookupShardPrimaries(cfg.Region, id, shardReplicas)
+	}).(pulumi.StringMapOutput)
+	nodeAzs := lookupNodeAzs(ctx, awsProvider, replicationGroupId, shardReplicas)
+	primaryPlacement := pulumi.All(shardPrimaries, nodeAzs).ApplyT(func(args []interface{}) map[string]string {
+		primaries, azs := args[0].(map[string]string), args[1].(map[string]string)
+		placement := map[string]string{}
+		for shard := 1; shard <= numShards; shard++ {
+			key := fmt.Sprintf("%04d", shard)
+			placement[key] = "unknown"
+			if node, ok := primaries[key]; ok {
+				placement[key] = azs[node]
+			}
+		}
+		return placement
+	}).(pulumi.StringMapOutput)
+
+	clientConfigJSON := pulumi.All(
+		replicationGroup.ClusterEnabled,
+		replicationGroup.ConfigurationEndpointAddress,
+		replicationGroup.Port.Elem(),
+		replicationGroup.TransitEncryptionEnabled,
+	).ApplyT(func(args []interface{}) (string, error) {
+		bytes, err := json.Marshal(clientConfig{
+			ClusterMode: args[0].(bool),
+			Endpoint:    args[1].(string),
+			Port:        args[2].(int),
+			Tls:         args[3].(bool),
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	// With auto scaling, shard and replica counts are expected to drift from the request
+	configDiff := pulumi.All(
+		replicationGroup.NodeType,
+		replicationGroup.NumNodeGroups,
+		replicationGroup.ReplicasPerNodeGroup,
+		replicationGroup.EngineVersionActual,
+	).ApplyT(func(args []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"nodeType":             configDiffEntry(cluster.NodeType, args[0].(string)),
+			"numNodeGroups":        configDiffEntry(strconv.Itoa(numShards), strconv.Itoa(args[1].(int))),
+			"replicasPerNodeGroup": configDiffEntry(strconv.Itoa(baseReplicas), strconv.Itoa(args[2].(int))),
+			"engineVersion":        configDiffEntry(engine.Version, args[3].(string)),
+		}
+	}).(pulumi.MapOutput)
+
 	return &ElastiCacheResult{
-		ConfigurationEndpoint: replicationGroup.ConfigurationEndpointAddress,
-		ReplicationGroupId:    replicationGroup.ReplicationGroupId,
+		ConfigurationEndpoint:    replicationGroup.ConfigurationEndpointAddress,
+		ReplicationGroupId:       replicationGroupId,
+		ReplicationGroupArn:      replicationGroup.Arn,
+		Port:                     replicationGroup.Port.Elem(),
+		TransitEncryptionEnabled: replicationGroup.TransitEncryptionEnabled,
+		ClusterEnabled:           replicationGroup.ClusterEnabled,
+		ParameterGroupName:       parameterGroupName,
+		PrimaryAz:                primaryPlacement.MapIndex(pulumi.String("0001")),
+		PrimaryPlacement:         primaryPlacement,
+		ShardPrimaries:           shardPrimaries,
+		ClientConfig:             clientConfigJSON,
+		ConfigDiff:               configDiff,
+		ShardReplicas:            shardReplicas,
+		EngineLogGroupName:       engineLogGroupName,
+		SlowLogGroupName:         slowLogGroupName,
 	}, nil
 }
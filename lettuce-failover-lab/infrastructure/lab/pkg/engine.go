@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	elasticachesdk "github.com/aws/aws-sdk-go-v2/service/elasticache"
+)
+
+// EngineVersion is an ElastiCache engine version and its parameter group family
+type EngineVersion struct {
+	Version string
+	Family  string
+}
+
+// latestEngineVersions caches ResolveLatestEngineVersion results for the run, keyed by engine
+var (
+	latestEngineVersionsMu sync.Mutex
+	latestEngineVersions   = map[string]EngineVersion{}
+)
+
+// ResolveLatestEngineVersion returns the newest engine version ElastiCache supports for
+// engine in region, with its parameter group family
+// pulumi-aws has no engine-version lookup, so this reads them through the AWS SDK
+func ResolveLatestEngineVersion(region, engine string) (EngineVersion, error) {
+	latestEngineVersionsMu.Lock()
+	defer latestEngineVersionsMu.Unlock()
+	if cached, ok := latestEngineVersions[engine]; ok {
+		return cached, nil
+	}
+
+	cfg, err := sdkConfig(region)
+	if err != nil {
+		return EngineVersion{}, err
+	}
+	var latest EngineVersion
+	pages := elasticachesdk.NewDescribeCacheEngineVersionsPaginator(elasticachesdk.NewFromConfig(cfg), &elasticachesdk.DescribeCacheEngineVersionsInput{
+		Engine: awssdk.String(engine),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return EngineVersion{}, fmt.Errorf("describing %s engine versions: %w", engine, err)
+		}
+		for _, v := range page.CacheEngineVersions {
+			version := awssdk.ToString(v.EngineVersion)
+			if latest.Version == "" || compareVersions(version, latest.Version) > 0 {
+				latest = EngineVersion{Version: version, Family: awssdk.ToString(v.CacheParameterGroupFamily)}
+			}
+		}
+	}
+	if latest.Version == "" {
+		return EngineVersion{}, fmt.Errorf("no %s engine versions are offered in this region", engine)
+	}
+
+	// From 6.x the replication group takes major.minor, e.g. 7.1 rather than 7.1.0
+	if parts := strings.Split(latest.Version, "."); len(parts) > 2 && compareVersions(parts[0], "6") >= 0 {
+		latest.Version = parts[0] + "." + parts[1]
+	}
+
+	latestEngineVersions[engine] = latest
+	return latest, nil
+}
+
+// resolveEngineVersion maps the engineVersion config to a version and parameter group
+// family, looking up the newest version when it is "latest"
+func resolveEngineVersion(region, engineVersion string) (EngineVersion, error) {
+	if engineVersion == "latest" {
+		return ResolveLatestEngineVersion(region, "redis")
+	}
+
+	major := strings.SplitN(engineVersion, ".", 2)[0]
+	switch major {
+	case "7":
+		return EngineVersion{Version: engineVersion, Family: "redis7"}, nil
+	case "6":
+		return EngineVersion{Version: engineVersion, Family: "redis6.x"}, nil
+	// Legacy engines, for reproducing client behavior against them; see preSixEngine
+	case "5":
+		return EngineVersion{Version: engineVersion, Family: "redis5.0"}, nil
+	case "4":
+		return EngineVersion{Version: engineVersion, Family: "redis4.0"}, nil
+	}
+	return EngineVersion{}, fmt.Errorf("engineVersion %s is not supported; use 4.0.10, 5.0.x, 6.x, 7.x or latest", engineVersion)
+}
+
+// knownParameterTable lists the modifiable parameters of each parameter group family
+//
+//go:embed known_parameters.json
+var knownParameterTable []byte
+
+// validateParameterOverrides rejects overrides the family does not define, so a typo
+// or an unsupported parameter fails at plan time rather than when AWS applies it.
+// Families without a table, such as the legacy redis5.0 and redis4.0, are left to AWS
+func validateParameterOverrides(family string, overrides map[string]string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	var table map[string]interface{}
+	if err := json.Unmarshal(knownParameterTable, &table); err != nil {
+		return fmt.Errorf("invalid embedded parameter table: %w", err)
+	}
+	list, ok := table[family].([]interface{})
+	if !ok {
+		return nil
+	}
+	known := map[string]bool{}
+	for _, name := range list {
+		known[name.(string)] = true
+	}
+
+	var problems []string
+	for name := range overrides {
+		switch {
+		case known[name]:
+		// TLS versions and ciphers are fixed by ElastiCache, see tlsPolicyForEngine
+		case strings.HasPrefix(name, "tls-"):
+			problems = append(problems, fmt.Sprintf("%s (ElastiCache does not expose TLS parameters)", name))
+		default:
+			problems = append(problems, name)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("parameterOverrides: not parameters of family %s: %s", family, strings.Join(problems, ", "))
+}
+
+// validateExistingParameterGroup checks that the parameter group named name belongs
+// to family and enables cluster mode, and, for the failover observer, emits the
+// keyspace events it subscribes to, since the lab cannot set them on a group it
+// does not own. pulumi-aws has no parameter group lookup, so this reads it through
+// the AWS SDK
+func validateExistingParameterGroup(region, name, family string, keyspaceEvents bool) error {
+	cfg, err := sdkConfig(region)
+	if err != nil {
+		return fmt.Errorf("existingParameterGroupName %s: %w", name, err)
+	}
+	client := elasticachesdk.NewFromConfig(cfg)
+
+	groups, err := client.DescribeCacheParameterGroups(context.Background(), &elasticachesdk.DescribeCacheParameterGroupsInput{
+		CacheParameterGroupName: awssdk.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("existingParameterGroupName %s: describing parameter group: %w", name, err)
+	}
+	if len(groups.CacheParameterGroups) == 0 {
+		return fmt.Errorf("existingParameterGroupName %s: parameter group not found", name)
+	}
+	if groupFamily := awssdk.ToString(groups.CacheParameterGroups[0].CacheParameterGroupFamily); groupFamily != family {
+		return fmt.Errorf("existingParameterGroupName %s: family %s does not match engine family %s", name, groupFamily, family)
+	}
+
+	values := map[string]string{}
+	pages := elasticachesdk.NewDescribeCacheParametersPaginator(client, &elasticachesdk.DescribeCacheParametersInput{
+		CacheParameterGroupName: awssdk.String(name),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return fmt.Errorf("existingParameterGroupName %s: describing parameters: %w", name, err)
+		}
+		for _, p := range page.Parameters {
+			values[awssdk.ToString(p.ParameterName)] = awssdk.ToString(p.ParameterValue)
+		}
+	}
+
+	// The lab always creates cluster mode enabled replication groups
+	if values["cluster-enabled"] != "yes" {
+		return fmt.Errorf("existingParameterGroupName %s: cluster-enabled is %q, the lab requires yes", name, values["cluster-enabled"])
+	}
+	// A is an alias for every event class, including $
+	if events := values["notify-keyspace-events"]; keyspaceEvents &&
+		!(strings.Contains(events, "K") && strings.ContainsAny(events, "$A")) {
+		return fmt.Errorf("existingParameterGroupName %s: notify-keyspace-events is %q, the failover observer requires K$", name, events)
+	}
+	return nil
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// preSixEngine reports whether engineVersion is a 4.x or 5.x engine, which the lab
+// only runs with encryption off
+func preSixEngine(engineVersion string) bool {
+	return strings.HasPrefix(engineVersion, "4.") || strings.HasPrefix(engineVersion, "5.")
+}
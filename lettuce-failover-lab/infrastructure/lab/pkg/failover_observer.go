@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"strconv"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	appsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// observerHeartbeatKey is written continuously; its keyspace notifications are the
+// observer's view of the shard that owns it
+const observerHeartbeatKey = "observer:heartbeat"
+
+// failoverObserverSource writes a heartbeat key and subscribes to its keyspace
+// notifications on the owning primary. A notification gap of at least
+// FAILOVER_GAP_MS is published as observer.failover.detected.ms, at one-second
+// resolution and with the app's RunId dimension
+const failoverObserverSource = `import os
+import threading
+import time
+
+import boto3
+import redis
+from redis.cluster import RedisCluster
+
+host, port = os.environ["REDIS_CLUSTER_ENDPOINT"].rsplit(":", 1)
+key = os.environ["HEARTBEAT_KEY"]
+ssl = os.environ["REDIS_SSL_ENABLED"] == "true"
+interval = int(os.environ["HEARTBEAT_INTERVAL_MS"]) / 1000
+gap_threshold_ms = int(os.environ["FAILOVER_GAP_MS"])
+run_id = os.environ["LAB_RUN_ID"]
+cloudwatch = boto3.client("cloudwatch", region_name=os.environ["AWS_REGION"])
+last_seen = time.monotonic()
+
+
+def write_heartbeats():
+    cluster = None
+    while True:
+        try:
+            cluster = cluster or RedisCluster(host=host, port=int(port), ssl=ssl)
+            cluster.set(key, time.time())
+        except redis.RedisError as e:
+            print("heartbeat failed: %s" % e, flush=True)
+            cluster = None
+        time.sleep(interval)
+
+
+def publish(gap_ms):
+    print("failover detected after %.0f ms without notifications" % gap_ms, flush=True)
+    cloudwatch.put_metric_data(Namespace="RedisFailoverLab", MetricData=[{
+        "MetricName": "observer.failover.detected.ms",
+        "Dimensions": [{"Name": "RunId", "Value": run_id}],
+        "Value": gap_ms,
+        "Unit": "Milliseconds",
+        "StorageResolution": 1,
+    }])
+
+
+def observe():
+    global last_seen
+    while True:
+        try:
+            # Keyspace notifications are node-local, so follow the key's current primary
+            node = RedisCluster(host=host, port=int(port), ssl=ssl).get_node_from_key(key)
+            pubsub = redis.Redis(host=node.host, port=node.port, ssl=ssl).pubsub()
+            pubsub.subscribe("__keyspace@0__:" + key)
+            for message in pubsub.listen():
+                if message["type"] != "message":
+                    continue
+                now = time.monotonic()
+                gap_ms = (now - last_seen) * 1000
+                last_seen = now
+                if gap_ms >= gap_threshold_ms:
+                    publish(gap_ms)
+        except redis.RedisError as e:
+            print("subscription lost: %s" % e, flush=True)
+            time.sleep(interval)
+
+
+threading.Thread(target=write_heartbeats, daemon=True).start()
+observe()
+`
+
+type FailoverObserverResult struct {
+	DeploymentName pulumi.StringOutput
+}
+
+// DeployFailoverObserver runs a single pod that measures failover detection latency
+// from a client's perspective, independent of the app, and publishes it to CloudWatch
+// using the node role. Requires keyspace notifications, which the parameter group
+// enables when deployFailoverObserver is set
+func DeployFailoverObserver(ctx *pulumi.Context, provider *kubernetes.Provider, namespace *corev1.Namespace, redisEndpoint pulumi.StringOutput, tls bool, region, runId string) (*FailoverObserverResult, error) {
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name":    pulumi.String("failover-observer"),
+		"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+	}
+
+	script, err := corev1.NewConfigMap(ctx, "failover-observer", &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("failover-observer"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Data: pulumi.StringMap{
+			"observer.py": pulumi.String(failoverObserverSource),
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err := appsv1.NewDeployment(ctx, "failover-observer", &appsv1.DeploymentArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("failover-observer"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Spec: &appsv1.DeploymentSpecArgs{
+			Replicas: pulumi.Int(1),
+			Selector: &metav1.LabelSelectorArgs{
+				MatchLabels: labels,
+			},
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: labels,
+				},
+				Spec: &corev1.PodSpecArgs{
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:  pulumi.String("failover-observer"),
+							Image: pulumi.String("python:3.12-slim"),
+							Command: pulumi.StringArray{
+								pulumi.String("/bin/sh"),
+								pulumi.String("-c"),
+								pulumi.String("pip install --quiet redis==5.0.8 boto3==1.35.36 && exec python -u /observer/observer.py"),
+							},
+							Env: corev1.EnvVarArray{
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_CLUSTER_ENDPOINT"), Value: pulumi.Sprintf("%s:6379", redisEndpoint)},
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_SSL_ENABLED"), Value: pulumi.String(strconv.FormatBool(tls))},
+								&corev1.EnvVarArgs{Name: pulumi.String("HEARTBEAT_KEY"), Value: pulumi.String(observerHeartbeatKey)},
+								&corev1.EnvVarArgs{Name: pulumi.String("HEARTBEAT_INTERVAL_MS"), Value: pulumi.String("100")},
+								&corev1.EnvVarArgs{Name: pulumi.String("FAILOVER_GAP_MS"), Value: pulumi.String("1000")},
+								&corev1.EnvVarArgs{Name: pulumi.String("AWS_REGION"), Value: pulumi.String(region)},
+								&corev1.EnvVarArgs{Name: pulumi.String("LAB_RUN_ID"), Value: pulumi.String(runId)},
+							},
+							VolumeMounts: corev1.VolumeMountArray{
+								&corev1.VolumeMountArgs{
+									Name:      pulumi.String("observer"),
+									MountPath: pulumi.String("/observer"),
+								},
+							},
+							Resources: &corev1.ResourceRequirementsArgs{
+								Requests: pulumi.StringMap{
+									"memory": pulumi.String("64Mi"),
+									"cpu":    pulumi.String("50m"),
+								},
+								Limits: pulumi.StringMap{
+									"memory": pulumi.String("256Mi"),
+									"cpu":    pulumi.String("200m"),
+								},
+							},
+						},
+					},
+					Volumes: corev1.VolumeArray{
+						&corev1.VolumeArgs{
+							Name: pulumi.String("observer"),
+							ConfigMap: &corev1.ConfigMapVolumeSourceArgs{
+								Name: script.Metadata.Name(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FailoverObserverResult{
+		DeploymentName: deployment.Metadata.Name().Elem(),
+	}, nil
+}
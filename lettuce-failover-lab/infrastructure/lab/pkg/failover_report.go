@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// failoverReportSource summarizes the last windowHours of a test run: completed
+// failovers from the replication group's ElastiCache events, and the app's worst
+// connection drop, failed operations and sequence gaps from its CloudWatch metrics
+const failoverReportSource = `from datetime import datetime, timedelta, timezone
+
+import boto3
+
+cloudwatch = boto3.client("cloudwatch")
+elasticache = boto3.client("elasticache")
+sns = boto3.client("sns")
+
+
+def metric(name, statistic, run_id, start, end):
+    datapoints = cloudwatch.get_metric_statistics(
+        Namespace="RedisFailoverLab",
+        MetricName=name,
+        Dimensions=[{"Name": "RunId", "Value": run_id}],
+        StartTime=start,
+        EndTime=end,
+        Period=int((end - start).total_seconds()),
+        Statistics=[statistic],
+    )["Datapoints"]
+    return max((point[statistic] for point in datapoints), default=0)
+
+
+def failover_count(replication_group_id, start, end):
+    count = 0
+    pages = elasticache.get_paginator("describe_events").paginate(
+        SourceType="cache-cluster", StartTime=start, EndTime=end)
+    for page in pages:
+        for event in page["Events"]:
+            message = event["Message"].lower()
+            if (event["SourceIdentifier"].startswith(replication_group_id + "-")
+                    and "failover" in message and "completed" in message):
+                count += 1
+    return count
+
+
+def handler(event, context):
+    end = datetime.now(timezone.utc).replace(second=0, microsecond=0)
+    start = end - timedelta(hours=event["windowHours"])
+    summary = {
+        "failovers": failover_count(event["replicationGroupId"], start, end),
+        "maxRecoveryMs": metric("connection.drop.duration.ms", "Maximum", event["runId"], start, end),
+        "failedOperations": metric("operations.failed.during.failover", "Sum", event["runId"], start, end),
+        "sequenceGaps": metric("getset.sequence.gaps", "Sum", event["runId"], start, end),
+    }
+
+    lines = [
+        "Lettuce Failover Lab report for %s, %s to %s" % (
+            event["replicationGroupId"], start.isoformat(), end.isoformat()),
+        "",
+        "Failovers completed:      %d" % summary["failovers"],
+        "Max recovery time (ms):   %d" % summary["maxRecoveryMs"],
+        "Failed operations:        %d" % summary["failedOperations"],
+        "Sequence gaps:            %d" % summary["sequenceGaps"],
+    ]
+    sns.publish(
+        TopicArn=event["topicArn"],
+        Subject="Failover Lab report: %d failovers, %d sequence gaps" % (
+            summary["failovers"], summary["sequenceGaps"]),
+        Message="\n".join(lines),
+    )
+    return summary
+`
+
+type FailoverReportResult struct {
+	FunctionName pulumi.StringOutput
+}
+
+// CreateFailoverReport publishes a post-run summary to topicArn on
+// cfg.FailoverReportSchedule, covering the preceding cfg.FailoverReportWindowHours
+// of the app metrics tagged with runId
+func CreateFailoverReport(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, replicationGroupId pulumi.StringOutput, topicArn pulumi.StringOutput, runId string) (*FailoverReportResult, error) {
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, "redis-failover-lab-failover-report-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-failover-report-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, "redis-failover-lab-failover-report-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	reportPolicyDocument := topicArn.ApplyT(func(arn string) (string, error) {
+		policy, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"cloudwatch:GetMetricStatistics", "elasticache:DescribeEvents"},
+					"Resource": "*",
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   "sns:Publish",
+					"Resource": arn,
+				},
+			},
+		})
+		return string(policy), err
+	}).(pulumi.StringOutput)
+	reportPolicy, err := iam.NewRolePolicy(ctx, "redis-failover-lab-failover-report-policy", &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: reportPolicyDocument,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, "redis-failover-lab-failover-report", &lambda.FunctionArgs{
+		Description: pulumi.String("Publishes a summary of the last Failover Lab test run"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(60),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(failoverReportSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-failover-report"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, reportPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := cloudwatch.NewEventRule(ctx, "redis-failover-lab-failover-report", &cloudwatch.EventRuleArgs{
+		Description:        pulumi.String("Schedules the Failover Lab test run report"),
+		ScheduleExpression: pulumi.String(cfg.FailoverReportSchedule),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-failover-report"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	permission, err := lambda.NewPermission(ctx, "redis-failover-lab-failover-report", &lambda.PermissionArgs{
+		Action:    pulumi.String("lambda:InvokeFunction"),
+		Function:  function.Name,
+		Principal: pulumi.String("events.amazonaws.com"),
+		SourceArn: rule.Arn,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := pulumi.All(replicationGroupId, topicArn).ApplyT(func(args []interface{}) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"replicationGroupId": args[0].(string),
+			"topicArn":           args[1].(string),
+			"windowHours":        cfg.FailoverReportWindowHours,
+			"runId":              runId,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+	_, err = cloudwatch.NewEventTarget(ctx, "redis-failover-lab-failover-report", &cloudwatch.EventTargetArgs{
+		Rule:  rule.Name,
+		Arn:   function.Arn,
+		Input: input,
+	}, pulumi.DependsOn([]pulumi.Resource{permission}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FailoverReportResult{
+		FunctionName: function.Name,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type GrafanaDatasourceResult struct {
+	ParameterName pulumi.StringOutput
+}
+
+// grafanaDatasourceJSON renders a CloudWatch datasource definition for the lab's
+// metrics, plus the namespaces and node dimensions the lab dashboards query
+func grafanaDatasourceJSON(region, replicationGroupId string, shardReplicas []int) (string, error) {
+	var cacheClusterIds []string
+	for _, node := range nodeSuffixes(shardReplicas) {
+		cacheClusterIds = append(cacheClusterIds, fmt.Sprintf("%s-%s", replicationGroupId, node))
+	}
+
+	bytes, err := json.Marshal(map[string]interface{}{
+		"datasource": map[string]interface{}{
+			"name":   "RedisFailoverLab CloudWatch",
+			"type":   "cloudwatch",
+			"access": "proxy",
+			"jsonData": map[string]string{
+				"authType":                "default",
+				"defaultRegion":           region,
+				"customMetricsNamespaces": "RedisFailoverLab",
+			},
+		},
+		"region":     region,
+		"namespaces": []string{"AWS/ElastiCache", "RedisFailoverLab"},
+		"defaultDimensions": map[string]interface{}{
+			"AWS/ElastiCache": map[string]interface{}{
+				"CacheClusterId": cacheClusterIds,
+			},
+		},
+	})
+	return string(bytes), err
+}
+
+// ExportGrafanaDatasource writes the lab's CloudWatch datasource definition to an SSM
+// parameter in the Grafana workspace region, so Amazon Managed Grafana can be pointed
+// at the lab's metrics without retyping region, namespaces and dimensions
+// The parameter is tagged with runId like the lab's other resources
+func ExportGrafanaDatasource(ctx *pulumi.Context, replicationGroupId pulumi.StringOutput, shardReplicas []int, region, workspaceRegion, runId string) (*GrafanaDatasourceResult, error) {
+	// The workspace may live in a different region than the lab
+	workspaceProvider, err := aws.NewProvider(ctx, "redis-failover-lab-grafana-region", &aws.ProviderArgs{
+		Region:      pulumi.String(workspaceRegion),
+		DefaultTags: runDefaultTags(runId),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	datasource := replicationGroupId.ApplyT(func(rgId string) (string, error) {
+		return grafanaDatasourceJSON(region, rgId, shardReplicas)
+	}).(pulumi.StringOutput)
+
+	parameter, err := ssm.NewParameter(ctx, "redis-failover-lab-grafana-datasource", &ssm.ParameterArgs{
+		Name:        pulumi.String("/redis-failover-lab/grafana/cloudwatch-datasource"),
+		Description: pulumi.String("CloudWatch datasource definition for the Failover Lab metrics"),
+		Type:        pulumi.String("String"),
+		Value:       datasource,
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-grafana-datasource"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(workspaceProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GrafanaDatasourceResult{
+		ParameterName: parameter.Name,
+	}, nil
+}
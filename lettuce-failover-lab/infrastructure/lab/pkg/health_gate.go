@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// healthGateChecks are the checks ClusterHealthGate runs unless cfg.HealthGateChecks
+// picks some of them
+var healthGateChecks = []string{"status", "primaries", "replicationLag"}
+
+// clusterHealthGateSource polls the replication group until every requested check
+// passes, and raises once the timeout passes with the checks still failing, which
+// fails the invocation and with it pulumi up:
+//   - status: the replication group, its node groups and member nodes are available
+//   - primaries: the IsMaster metric shows exactly one primary in each shard
+//   - replicationLag: the ReplicationLag metric of every replica is at most maxReplicationLag
+//
+// The metric checks read the latest datapoint of the last 10 minutes, so a new
+// cluster fails them until ElastiCache has published its first minute
+const clusterHealthGateSource = `import time
+from datetime import datetime, timedelta, timezone
+
+import boto3
+
+elasticache = boto3.client("elasticache")
+cloudwatch = boto3.client("cloudwatch")
+
+
+def describe_group(group_id):
+    return elasticache.describe_replication_groups(ReplicationGroupId=group_id)["ReplicationGroups"][0]
+
+
+def status_problems(group):
+    problems = []
+    if group["Status"] != "available":
+        problems.append("replication group is %s" % group["Status"])
+    for node_group in group["NodeGroups"]:
+        if node_group["Status"] != "available":
+            problems.append("shard %s is %s" % (node_group["NodeGroupId"], node_group["Status"]))
+    for member in group["MemberClusters"]:
+        cluster = elasticache.describe_cache_clusters(CacheClusterId=member)["CacheClusters"][0]
+        if cluster["CacheClusterStatus"] != "available":
+            problems.append("node %s is %s" % (member, cluster["CacheClusterStatus"]))
+    return problems
+
+
+def latest_metrics(members, metric):
+    end = datetime.now(timezone.utc)
+    queries = [
+        {
+            "Id": "m%d" % i,
+            "MetricStat": {
+                "Metric": {
+                    "Namespace": "AWS/ElastiCache",
+                    "MetricName": metric,
+                    "Dimensions": [
+                        {"Name": "CacheClusterId", "Value": member},
+                        {"Name": "CacheNodeId", "Value": "0001"},
+                    ],
+                },
+                "Period": 60,
+                "Stat": "Maximum",
+            },
+        }
+        for i, member in enumerate(members)
+    ]
+    latest = {}
+    for start in range(0, len(queries), 500):
+        results = cloudwatch.get_metric_data(
+            MetricDataQueries=queries[start:start + 500],
+            StartTime=end - timedelta(minutes=10),
+            EndTime=end,
+        )["MetricDataResults"]
+        for result in results:
+            if result["Values"]:
+                latest[members[int(result["Id"][1:])]] = result["Values"][0]
+    return latest
+
+
+def shard_of(member):
+    return member.rsplit("-", 2)[-2]
+
+
+def metric_problems(group, checks, max_lag):
+    members = group["MemberClusters"]
+    is_master = latest_metrics(members, "IsMaster")
+    problems = ["node %s has no IsMaster datapoint yet" % m for m in members if m not in is_master]
+    if problems:
+        return problems
+    if "primaries" in checks:
+        primaries = {}
+        for member in members:
+            primaries.setdefault(shard_of(member), 0)
+            primaries[shard_of(member)] += int(is_master[member] == 1)
+        problems += ["shard %s has %d primaries" % (s, n) for s, n in sorted(primaries.items()) if n != 1]
+    if "replicationLag" in checks:
+        replicas = [m for m in members if is_master[m] != 1]
+        lag = latest_metrics(replicas, "ReplicationLag")
+        for replica in replicas:
+            if replica not in lag:
+                problems.append("replica %s has no ReplicationLag datapoint yet" % replica)
+            elif lag[replica] > max_lag:
+                problems.append("replica %s lags %.1fs" % (replica, lag[replica]))
+    return problems
+
+
+def handler(event, context):
+    group_id = event["replicationGroupId"]
+    checks = event["checks"]
+    deadline = time.time() + event["timeoutSeconds"]
+    while True:
+        group = describe_group(group_id)
+        problems = status_problems(group) if "status" in checks else []
+        if not problems and ("primaries" in checks or "replicationLag" in checks):
+            problems = metric_problems(group, checks, event["maxReplicationLag"])
+        if not problems:
+            return {"healthy": True, "checks": checks}
+        if time.time() >= deadline:
+            raise Exception("%s unhealthy after %ds: %s" % (group_id, event["timeoutSeconds"], "; ".join(problems)))
+        time.sleep(15)
+`
+
+type ClusterHealthGateResult struct {
+	// Status is {healthy, checks} once every check passed
+	Status pulumi.MapOutput
+}
+
+// CreateClusterHealthGate waits, once the replication group exists, until it passes
+// cfg.HealthGateChecks, for up to cfg.HealthGateTimeout seconds. Unlike
+// WaitForEksNodes, a timeout fails pulumi up, naming the checks still failing. The
+// gate runs on create and again only when the group or the gate settings change
+func CreateClusterHealthGate(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, clusterKey string, redis *ElastiCacheResult) (*ClusterHealthGateResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-health-gate-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-health-gate-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-health-gate-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	describePolicy, err := iam.NewRolePolicy(ctx, prefix+"-health-gate-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": [
+						"elasticache:DescribeReplicationGroups",
+						"elasticache:DescribeCacheClusters",
+						"cloudwatch:GetMetricData"
+					],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-health-gate", &lambda.FunctionArgs{
+		Description: pulumi.String("Fails the deploy unless the Failover Lab cluster becomes healthy"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		// The wait plus headroom for the last poll
+		Timeout: pulumi.Int(cfg.HealthGateTimeout + 60),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(clusterHealthGateSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-health-gate"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, describePolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := redis.ReplicationGroupId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"replicationGroupId": id,
+			"checks":             cfg.HealthGateChecks,
+			"timeoutSeconds":     cfg.HealthGateTimeout,
+			"maxReplicationLag":  cfg.HealthGateMaxReplicationLag,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	invocation, err := lambda.NewInvocation(ctx, prefix+"-health-gate", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClusterHealthGateResult{
+		Status: invocation.Result.ApplyT(func(result string) (map[string]interface{}, error) {
+			var status map[string]interface{}
+			err := json.Unmarshal([]byte(result), &status)
+			return status, err
+		}).(pulumi.MapOutput),
+	}, nil
+}
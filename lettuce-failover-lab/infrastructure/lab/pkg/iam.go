@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// policyDocument is the subset of the IAM policy grammar checked before deploy
+type policyDocument struct {
+	Version   string `json:"Version"`
+	Statement []struct {
+		Effect   string      `json:"Effect"`
+		Action   interface{} `json:"Action"`
+		Resource interface{} `json:"Resource"`
+		// Trust policies name a Principal instead of a Resource
+		Principal interface{} `json:"Principal"`
+	} `json:"Statement"`
+}
+
+// validatePolicyDocument rejects policy JSON that does not parse or lacks the fields
+// IAM requires, so mistakes surface during pulumi preview
+func validatePolicyDocument(name, policy string) error {
+	var doc policyDocument
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w", name, err)
+	}
+	if doc.Version != "2012-10-17" {
+		return fmt.Errorf("%s: Version must be 2012-10-17, got %q", name, doc.Version)
+	}
+	if len(doc.Statement) == 0 {
+		return fmt.Errorf("%s has no statements", name)
+	}
+	for i, statement := range doc.Statement {
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			return fmt.Errorf("%s: statement %d Effect must be Allow or Deny, got %q", name, i, statement.Effect)
+		}
+		if statement.Action == nil {
+			return fmt.Errorf("%s: statement %d has no Action", name, i)
+		}
+		if statement.Resource == nil && statement.Principal == nil {
+			return fmt.Errorf("%s: statement %d has neither Resource nor Principal", name, i)
+		}
+	}
+	return nil
+}
+
+type ObserverRoleResult struct {
+	RoleArn pulumi.StringOutput
+}
+
+// CreateObserverRole creates a read-only IAM role for teammates observing the lab
+// principalArn is the IAM principal (account root, user, or role) allowed to assume it
+func CreateObserverRole(ctx *pulumi.Context, awsProvider *aws.Provider, principalArn string) (*ObserverRoleResult, error) {
+	trustPolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect": "Allow",
+				"Principal": map[string]string{
+					"AWS": principalArn,
+				},
+				"Action": "sts:AssumeRole",
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	observerRole, err := iam.NewRole(ctx, "redis-failover-lab-observer-role", &iam.RoleArgs{
+		Description:      pulumi.String("Read-only access to Failover Lab dashboards and ElastiCache"),
+		AssumeRolePolicy: pulumi.String(string(trustPolicy)),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-observer-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read-only access to metrics, dashboards, cluster state and logs
+	_, err = iam.NewRolePolicy(ctx, "redis-failover-lab-observer-policy", &iam.RolePolicyArgs{
+		Role: observerRole.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": [
+						"cloudwatch:Get*",
+						"elasticache:Describe*",
+						"logs:Get*"
+					],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObserverRoleResult{
+		RoleArn: observerRole.Arn,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// importEntry describes one lab resource for pulumi import --file: its Pulumi type,
+// the lab's resource name and the import ID, which is also the terraform import ID
+// of terraformType
+func importEntry(pulumiType, terraformType, name string, id pulumi.StringInput) pulumi.Map {
+	return pulumi.Map{
+		"type":             pulumi.String(pulumiType),
+		"name":             pulumi.String(name),
+		"id":               id,
+		"terraformAddress": pulumi.String(terraformType + "." + name),
+	}
+}
+
+// arnSuffix returns the part of arn after the last occurrence of sep, e.g. the role
+// name of a role ARN, for resources imported by name but only known by ARN
+func arnSuffix(arn pulumi.StringOutput, sep string) pulumi.StringOutput {
+	return arn.ApplyT(func(arn string) string {
+		return strings.TrimSuffix(arn[strings.LastIndex(arn, sep)+len(sep):], ":*")
+	}).(pulumi.StringOutput)
+}
+
+// ImportList lists the resources the lab creates, built from the result structs,
+// as {resources: [{type, name, id, terraformAddress}]}: the stack output can be
+// passed to pulumi import --file as is, and each terraformAddress and id make a
+// terraform import block. Resources pulumi-eks creates inside the cluster
+// component, the Lambdas and the Kubernetes workloads are left out
+func ImportList(cfg *LabConfig, eksResult *EKSResult, clusters map[string]*ElastiCacheResult, monitoring *MonitoringResult, maintenance *MaintenanceModeResult) pulumi.Map {
+	resources := pulumi.Array{
+		importEntry("aws:eks/cluster:Cluster", "aws_eks_cluster", "redis-failover-lab-eks", eksResult.ClusterName),
+		importEntry("aws:iam/role:Role", "aws_iam_role", "redis-failover-lab-eks-node-role", eksResult.NodeRoleName),
+		importEntry("aws:ec2/securityGroup:SecurityGroup", "aws_security_group", "redis-failover-lab-eks-cluster-sg", eksResult.ClusterSecurityGroupId),
+		importEntry("aws:ec2/securityGroup:SecurityGroup", "aws_security_group", "redis-failover-lab-eks-node-sg", eksResult.NodeSecurityGroupId),
+	}
+	if cfg.Adot {
+		resources = append(resources, importEntry("aws:iam/role:Role", "aws_iam_role", "redis-failover-lab-adot-collector-role", arnSuffix(eksResult.AdotCollectorRoleArn, "/")))
+	}
+	if cfg.AppMetricsRole {
+		resources = append(resources, importEntry("aws:iam/role:Role", "aws_iam_role", "redis-failover-lab-app-metrics-role", arnSuffix(eksResult.AppMetricsRoleArn, "/")))
+	}
+
+	keys := make([]string, 0, len(clusters))
+	for key := range clusters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		prefix := clusterResourcePrefix(key)
+		resources = append(resources, importEntry("aws:elasticache/replicationGroup:ReplicationGroup", "aws_elasticache_replication_group", prefix+"-redis", clusters[key].ReplicationGroupId))
+		// An existing parameter group is not the lab's to import
+		if cfg.ExistingParameterGroupName == "" {
+			resources = append(resources, importEntry("aws:elasticache/parameterGroup:ParameterGroup", "aws_elasticache_parameter_group", prefix+"-params", clusters[key].ParameterGroupName))
+		}
+	}
+
+	resources = append(resources,
+		importEntry("aws:cloudwatch/dashboard:Dashboard", "aws_cloudwatch_dashboard", "redis-failover-lab-dashboard", arnSuffix(monitoring.DashboardArn, "dashboard/")),
+		importEntry("aws:cloudwatch/logGroup:LogGroup", "aws_cloudwatch_log_group", "redis-failover-lab-logs", arnSuffix(monitoring.LogGroupArn, ":log-group:")),
+		importEntry("aws:sns/topic:Topic", "aws_sns_topic", "redis-failover-lab-alarms", monitoring.AlarmTopicArn),
+		importEntry("aws:cloudwatch/metricAlarm:MetricAlarm", "aws_cloudwatch_metric_alarm", "redis-failover-lab-failed-operations", arnSuffix(monitoring.FailedOpsAlarmArn, ":alarm:")),
+		importEntry("aws:ssm/parameter:Parameter", "aws_ssm_parameter", "redis-failover-lab-maintenance-mode", maintenance.ParameterName),
+	)
+	return pulumi.Map{"resources": resources}
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// observabilityNamespace holds in-cluster tooling managed by this stack, kept apart
+// from the app namespace that is applied with kubectl
+const observabilityNamespace = "redis-failover-lab-observability"
+
+// NewKubernetesProvider creates a Kubernetes provider targeting the lab's EKS cluster
+func NewKubernetesProvider(ctx *pulumi.Context, kubeconfig pulumi.AnyOutput) (*kubernetes.Provider, error) {
+	kubeconfigJson := kubeconfig.ApplyT(func(k interface{}) (string, error) {
+		bytes, err := json.Marshal(k)
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	return kubernetes.NewProvider(ctx, "redis-failover-lab-k8s", &kubernetes.ProviderArgs{
+		Kubeconfig: kubeconfigJson,
+	})
+}
+
+// CreateObservabilityNamespace creates the namespace for stack-managed in-cluster tooling
+func CreateObservabilityNamespace(ctx *pulumi.Context, provider *kubernetes.Provider) (*corev1.Namespace, error) {
+	return corev1.NewNamespace(ctx, observabilityNamespace, &corev1.NamespaceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name: pulumi.String(observabilityNamespace),
+			Labels: pulumi.StringMap{
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+		},
+	}, pulumi.Provider(provider))
+}
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type LettuceConfigResult struct {
+	// ApplicationYaml is the Spring Boot application.yaml fragment
+	ApplicationYaml pulumi.StringOutput
+	// ConfigMapName is the lettuce-config ConfigMap, set when a namespace was given
+	ConfigMapName pulumi.StringOutput
+}
+
+// lettuceApplicationYaml renders the spring.data.redis settings of a Spring Boot 3
+// app connecting with Lettuce to the cluster behind the configuration endpoint.
+// Periodic refresh runs every refreshPeriod, adaptive refresh reacts to MOVED/ASK
+// redirects and reconnects during a failover, and dynamic refresh sources let
+// Lettuce learn every node from the one endpoint
+func lettuceApplicationYaml(replicationGroupId, endpoint string, port int, tls bool, refreshPeriod string) string {
+	return fmt.Sprintf(`# Lettuce connection for ElastiCache replication group %s,
+# generated from the redis-failover-lab stack outputs
+spring:
+  data:
+    redis:
+      cluster:
+        nodes: %s:%d
+        max-redirects: 3
+      ssl:
+        enabled: %t
+      # The lab cluster has no auth token (clientConfig authSecretArn is null);
+      # with one, resolve it from its Secrets Manager secret, e.g.
+      # password: ${REDIS_AUTH_TOKEN}
+      lettuce:
+        cluster:
+          refresh:
+            period: %s
+            adaptive: true
+            dynamic-refresh-sources: true
+`, replicationGroupId, endpoint, port, tls, refreshPeriod)
+}
+
+// ExportLettuceConfig builds an application.yaml fragment matching the deployed
+// cluster, with the topology refresh period from cfg.LettuceRefreshPeriod. With a
+// namespace it is also written to the lettuce-config ConfigMap, to mount at
+// /config for Spring Boot to pick up
+func ExportLettuceConfig(ctx *pulumi.Context, provider *kubernetes.Provider, namespace pulumi.StringInput, cfg *LabConfig, redis *ElastiCacheResult) (*LettuceConfigResult, error) {
+	applicationYaml := pulumi.All(redis.ReplicationGroupId, redis.ConfigurationEndpoint, redis.Port, redis.TransitEncryptionEnabled).ApplyT(func(args []interface{}) string {
+		return lettuceApplicationYaml(args[0].(string), args[1].(string), args[2].(int), args[3].(bool), cfg.LettuceRefreshPeriod)
+	}).(pulumi.StringOutput)
+	result := &LettuceConfigResult{ApplicationYaml: applicationYaml}
+	if namespace == nil {
+		return result, nil
+	}
+
+	configMap, err := corev1.NewConfigMap(ctx, "lettuce-config", &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("lettuce-config"),
+			Namespace: namespace,
+			Labels: pulumi.StringMap{
+				"app.kubernetes.io/name":    pulumi.String("lettuce-config"),
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+		},
+		Data: pulumi.StringMap{
+			"application.yaml": applicationYaml,
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+	result.ConfigMapName = configMap.Metadata.Name().Elem()
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// validateLocalZone checks that zone is a Local Zone the account has opted in to and
+// that it offers nodeType. ElastiCache publishes no per-zone node type offerings, so
+// the EC2 offering of the matching instance type (cache.r5.large: r5.large) is used
+// as a proxy
+func validateLocalZone(ctx *pulumi.Context, awsProvider *aws.Provider, zone, nodeType string) error {
+	az, err := aws.GetAvailabilityZone(ctx, &aws.GetAvailabilityZoneArgs{
+		Name:                 pulumi.StringRef(zone),
+		AllAvailabilityZones: pulumi.BoolRef(true),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return fmt.Errorf("localZone %s: %w", zone, err)
+	}
+	if az.ZoneType != "local-zone" {
+		return fmt.Errorf("localZone %s: is a %s, not a local-zone", zone, az.ZoneType)
+	}
+	if az.OptInStatus == "not-opted-in" {
+		return fmt.Errorf("localZone %s: the account has not opted in to zone group %s", zone, az.GroupName)
+	}
+
+	instanceType := strings.TrimPrefix(nodeType, "cache.")
+	offerings, err := ec2.GetInstanceTypeOfferings(ctx, &ec2.GetInstanceTypeOfferingsArgs{
+		LocationType: pulumi.StringRef("availability-zone"),
+		Filters: []ec2.GetInstanceTypeOfferingsFilter{
+			{Name: "location", Values: []string{zone}},
+			{Name: "instance-type", Values: []string{instanceType}},
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return fmt.Errorf("localZone %s: %w", zone, err)
+	}
+	if len(offerings.InstanceTypes) == 0 {
+		return fmt.Errorf("localZone %s: node type %s is not offered there", zone, nodeType)
+	}
+	return nil
+}
+
+// selectSubnetsInZone returns the subnets of subnetIds in zone, preserving their order
+func selectSubnetsInZone(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string, zone string) ([]string, error) {
+	azs, err := subnetAzs(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, id := range subnetIds {
+		if azs[id] == zone {
+			selected = append(selected, id)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("localZone: no redisSubnetIds subnet in %s", zone)
+	}
+	return selected, nil
+}
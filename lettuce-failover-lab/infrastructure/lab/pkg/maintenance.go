@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// maintenanceModeParameterName is the SSM parameter the app polls for its mode
+const maintenanceModeParameterName = "/failover-lab/maintenance-mode"
+
+// maintenanceModes are the values the flag accepts, off first
+var maintenanceModes = []string{"off", "read-only", "degraded"}
+
+type MaintenanceModeResult struct {
+	ParameterName pulumi.StringOutput
+}
+
+// CreateMaintenanceModeParameter creates the maintenance-mode flag, initially off.
+// Chaos tooling flips it with set-maintenance-mode.sh during experiments, so later
+// updates leave its value alone instead of resetting it to off
+func CreateMaintenanceModeParameter(ctx *pulumi.Context, awsProvider *aws.Provider) (*MaintenanceModeResult, error) {
+	parameter, err := ssm.NewParameter(ctx, "redis-failover-lab-maintenance-mode", &ssm.ParameterArgs{
+		Name:           pulumi.String(maintenanceModeParameterName),
+		Description:    pulumi.String("Failover Lab app mode: off, read-only or degraded"),
+		Type:           pulumi.String("String"),
+		Value:          pulumi.String(maintenanceModes[0]),
+		AllowedPattern: pulumi.String("^(" + strings.Join(maintenanceModes, "|") + ")$"),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-maintenance-mode"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.IgnoreChanges([]string{"value"}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MaintenanceModeResult{
+		ParameterName: parameter.Name,
+	}, nil
+}
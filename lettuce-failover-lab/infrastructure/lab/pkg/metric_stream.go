@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kinesis"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type MetricStreamResult struct {
+	StreamArn pulumi.StringOutput
+	BucketArn pulumi.StringOutput
+}
+
+// CreateMetricStream streams the AWS/ElastiCache and lab app metrics to S3 through a
+// Firehose delivery stream, keeping a copy of a test run's metrics past CloudWatch's
+// retention of high-resolution and 1-minute datapoints. The destination is the
+// bucket named cfg.MetricStreamBucket, or a new bucket when it is unset
+func CreateMetricStream(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig) (*MetricStreamResult, error) {
+	bucketArn := pulumi.Sprintf("arn:aws:s3:::%s", cfg.MetricStreamBucket)
+	if cfg.MetricStreamBucket == "" {
+		bucket, err := s3.NewBucketV2(ctx, "redis-failover-lab-metric-stream", &s3.BucketV2Args{
+			ForceDestroy: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name":        pulumi.String("redis-failover-lab-metric-stream"),
+				"Environment": pulumi.String("testing"),
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		bucketArn = bucket.Arn
+	}
+
+	// Create IAM role for Firehose to write to the bucket
+	firehoseAssumeRolePolicy, err := createAssumeRolePolicy("firehose.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	firehoseRole, err := iam.NewRole(ctx, "redis-failover-lab-metric-stream-firehose-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(firehoseAssumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-metric-stream-firehose-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	firehosePolicy := bucketArn.ApplyT(func(bucketArn string) (string, error) {
+		policy, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect": "Allow",
+					"Action": []string{
+						"s3:AbortMultipartUpload",
+						"s3:GetBucketLocation",
+						"s3:GetObject",
+						"s3:ListBucket",
+						"s3:ListBucketMultipartUploads",
+						"s3:PutObject",
+					},
+					"Resource": []string{bucketArn, bucketArn + "/*"},
+				},
+			},
+		})
+		return string(policy), err
+	}).(pulumi.StringOutput)
+
+	firehoseRolePolicy, err := iam.NewRolePolicy(ctx, "redis-failover-lab-metric-stream-firehose-policy", &iam.RolePolicyArgs{
+		Role:   firehoseRole.Name,
+		Policy: firehosePolicy,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveryStream, err := kinesis.NewFirehoseDeliveryStream(ctx, "redis-failover-lab-metric-stream", &kinesis.FirehoseDeliveryStreamArgs{
+		Destination: pulumi.String("extended_s3"),
+		ExtendedS3Configuration: &kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationArgs{
+			BucketArn: bucketArn,
+			RoleArn:   firehoseRole.Arn,
+			Prefix:    pulumi.String("metric-stream/"),
+			// Flush at least every minute so a run's metrics land shortly after it
+			BufferingInterval: pulumi.Int(60),
+			BufferingSize:     pulumi.Int(5),
+			CompressionFormat: pulumi.String("GZIP"),
+		},
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-metric-stream"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{firehoseRolePolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create IAM role for CloudWatch to put records to the delivery stream
+	streamAssumeRolePolicy, err := createAssumeRolePolicy("streams.metrics.cloudwatch.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	streamRole, err := iam.NewRole(ctx, "redis-failover-lab-metric-stream-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(streamAssumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-metric-stream-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	streamPolicy := deliveryStream.Arn.ApplyT(func(deliveryStreamArn string) (string, error) {
+		policy, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"firehose:PutRecord", "firehose:PutRecordBatch"},
+					"Resource": deliveryStreamArn,
+				},
+			},
+		})
+		return string(policy), err
+	}).(pulumi.StringOutput)
+
+	streamRolePolicy, err := iam.NewRolePolicy(ctx, "redis-failover-lab-metric-stream-policy", &iam.RolePolicyArgs{
+		Role:   streamRole.Name,
+		Policy: streamPolicy,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := cloudwatch.NewMetricStream(ctx, "redis-failover-lab-metric-stream", &cloudwatch.MetricStreamArgs{
+		Name:         pulumi.String("redis-failover-lab-metric-stream"),
+		FirehoseArn:  deliveryStream.Arn,
+		RoleArn:      streamRole.Arn,
+		OutputFormat: pulumi.String("json"),
+		IncludeFilters: cloudwatch.MetricStreamIncludeFilterArray{
+			&cloudwatch.MetricStreamIncludeFilterArgs{Namespace: pulumi.String("AWS/ElastiCache")},
+			&cloudwatch.MetricStreamIncludeFilterArgs{Namespace: pulumi.String(labMetricsNamespace)},
+		},
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-metric-stream"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{streamRolePolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetricStreamResult{
+		StreamArn: stream.Arn,
+		BucketArn: bucketArn,
+	}, nil
+}
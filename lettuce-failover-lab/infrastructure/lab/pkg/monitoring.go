@@ -2,211 +2,383 @@ package pkg
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/elasticache"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sns"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
 type MonitoringResult struct {
-	DashboardArn pulumi.StringOutput
-	LogGroupArn  pulumi.StringOutput
+	DashboardArn      pulumi.StringOutput
+	LogGroupArn       pulumi.StringOutput
+	AlarmTopicArn     pulumi.StringOutput
+	FailedOpsAlarmArn pulumi.StringOutput
+	GrafanaDashboard  pulumi.StringOutput
+	// ShardAlarmArns are the per-shard composite alarms keyed shard1, shard2, ... and
+	// ShardsAlarmArn the composite over all of them, set with cfg.ShardAlarms
+	ShardAlarmArns pulumi.StringMap
+	ShardsAlarmArn pulumi.StringOutput
+	// ReplicationGroupId is the monitored replication group
+	ReplicationGroupId pulumi.StringOutput
 }
 
-// CreateMonitoring creates CloudWatch dashboard and log groups for failover monitoring
-func CreateMonitoring(ctx *pulumi.Context, replicationGroupId pulumi.StringOutput) (*MonitoringResult, error) {
-	// Create log group for application logs
-	logGroup, err := cloudwatch.NewLogGroup(ctx, "redis-failover-lab-logs", &cloudwatch.LogGroupArgs{
-		Name:            pulumi.String("/redis-failover-lab/application"),
-		RetentionInDays: pulumi.Int(7),
+type LabHealthAlarmResult struct {
+	AlarmArn pulumi.StringOutput
+}
+
+// FailoverAnnotation marks a failover event on the sequence-gap widget
+// Value is an ISO 8601 timestamp, e.g. 2025-01-15T10:30:00Z
+type FailoverAnnotation struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// alarmName returns the alarm name for metric, <alarmNamePrefix>-<metric>, with a
+// -shard<n> suffix when shard is non-zero
+func (c *LabConfig) alarmName(metric string, shard int) string {
+	name := c.AlarmNamePrefix + "-" + metric
+	if shard > 0 {
+		name = fmt.Sprintf("%s-shard%d", name, shard)
+	}
+	return name
+}
+
+// alarmTags returns the tags every lab alarm carries
+func alarmTags(ctx *pulumi.Context, name string) pulumi.StringMap {
+	return pulumi.StringMap{
+		"Name":        pulumi.String(name),
+		"Project":     pulumi.String(ctx.Project()),
+		"Environment": pulumi.String("testing"),
+	}
+}
+
+// MonitoringSource is the cluster the dashboard and alarms watch
+type MonitoringSource struct {
+	ReplicationGroupId pulumi.StringOutput
+	// ShardReplicas is the replica count of each shard, as the cluster was created with
+	ShardReplicas []int
+	// EksClusterName feeds the EKS node panels added with cfg.IncludeEksWidgets
+	EksClusterName pulumi.StringOutput
+	// RunId is the RunId dimension the app metrics are charted and alarmed on
+	RunId string
+}
+
+// MonitoringSourceFromStack reads the cluster to monitor from the outputs of the lab
+// stack stackRef, for a monitoring stack deployed on its own. The shard layout plans
+// the per-shard alarms and the runId is rendered into the dashboards, so both are
+// read now rather than kept as outputs
+func MonitoringSourceFromStack(ctx *pulumi.Context, stackRef string) (*MonitoringSource, error) {
+	stack, err := pulumi.NewStackReference(ctx, stackRef, nil)
+	if err != nil {
+		return nil, err
+	}
+	details, err := stack.GetOutputDetails("redisShardReplicas")
+	if err != nil {
+		return nil, fmt.Errorf("monitoringSourceStackRef %s: %w", stackRef, err)
+	}
+	values, ok := details.Value.([]interface{})
+	if !ok || len(values) != numShards {
+		return nil, fmt.Errorf("monitoringSourceStackRef %s: no redisShardReplicas output for %d shards; update that stack first", stackRef, numShards)
+	}
+	var shardReplicas []int
+	for _, value := range values {
+		replicas, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("monitoringSourceStackRef %s: redisShardReplicas holds %v, not replica counts", stackRef, value)
+		}
+		shardReplicas = append(shardReplicas, int(replicas))
+	}
+	runId, err := stack.GetOutputDetails("runId")
+	if err != nil {
+		return nil, fmt.Errorf("monitoringSourceStackRef %s: %w", stackRef, err)
+	}
+	if _, ok := runId.Value.(string); !ok {
+		return nil, fmt.Errorf("monitoringSourceStackRef %s: no runId output; update that stack first", stackRef)
+	}
+	return &MonitoringSource{
+		ReplicationGroupId: stack.GetStringOutput(pulumi.String("redisReplicationGroupId")),
+		ShardReplicas:      shardReplicas,
+		EksClusterName:     stack.GetStringOutput(pulumi.String("eksClusterName")),
+		RunId:              runId.Value.(string),
+	}, nil
+}
+
+// CreateMonitoring creates CloudWatch dashboard, log groups and alarms for failover monitoring
+// of source. With cfg.MonitoringSourceStackRef set the stack only monitors: the app
+// log group stays with the lab, and the topic and dashboard are named from
+// cfg.AlarmNamePrefix so they can sit next to the lab's own
+func CreateMonitoring(ctx *pulumi.Context, awsProvider *aws.Provider, source *MonitoringSource, cfg *LabConfig) (*MonitoringResult, error) {
+	replicationGroupId, shardReplicas := source.ReplicationGroupId, source.ShardReplicas
+	topicName, dashboardName := "redis-failover-lab-alarms", "RedisFailoverLab-Dashboard"
+	if cfg.MonitoringSourceStackRef != "" {
+		topicName, dashboardName = cfg.AlarmNamePrefix+"-alarms", cfg.AlarmNamePrefix+"-dashboard"
+	}
+
+	result := &MonitoringResult{ReplicationGroupId: replicationGroupId}
+	if cfg.MonitoringSourceStackRef == "" {
+		// Create log group for application logs, optionally kept on destroy for post-mortems
+		logGroup, err := cloudwatch.NewLogGroup(ctx, "redis-failover-lab-logs", &cloudwatch.LogGroupArgs{
+			Name:            pulumi.String("/redis-failover-lab/application"),
+			RetentionInDays: pulumi.Int(cfg.LogRetentionDays),
+			Tags: pulumi.StringMap{
+				"Name":        pulumi.String("redis-failover-lab-logs"),
+				"Environment": pulumi.String("testing"),
+			},
+		}, pulumi.RetainOnDelete(cfg.RetainLogsOnDestroy), pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		result.LogGroupArn = logGroup.Arn
+	}
+
+	// Create SNS topic that lab alarms notify
+	alarmTopic, err := sns.NewTopic(ctx, "redis-failover-lab-alarms", &sns.TopicArgs{
+		Name: pulumi.String(topicName),
 		Tags: pulumi.StringMap{
-			"Name":        pulumi.String("redis-failover-lab-logs"),
+			"Name":        pulumi.String(topicName),
 			"Environment": pulumi.String("testing"),
 		},
-	})
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Alarm on operations lost during failover - the lab's key correctness signal,
+	// in the monitored run
+	failedOpsAlarmName := cfg.alarmName("failed-operations", 0)
+	failedOpsAlarm, err := cloudwatch.NewMetricAlarm(ctx, "redis-failover-lab-failed-operations", &cloudwatch.MetricAlarmArgs{
+		Name:               pulumi.String(failedOpsAlarmName),
+		AlarmDescription:   pulumi.String("Operations failed during failover exceeded the configured threshold"),
+		Namespace:          pulumi.String("RedisFailoverLab"),
+		MetricName:         pulumi.String("operations.failed.during.failover"),
+		Dimensions:         pulumi.StringMap{"RunId": pulumi.String(source.RunId)},
+		Statistic:          pulumi.String("Sum"),
+		Period:             pulumi.Int(cfg.FailedOpsAlarmWindowSeconds),
+		EvaluationPeriods:  pulumi.Int(1),
+		Threshold:          pulumi.Float64(cfg.FailedOpsAlarmThreshold),
+		ComparisonOperator: pulumi.String("GreaterThanThreshold"),
+		TreatMissingData:   pulumi.String("notBreaching"),
+		AlarmActions:       pulumi.Array{alarmTopic.Arn},
+		OkActions:          pulumi.Array{alarmTopic.Arn},
+		Tags:               alarmTags(ctx, failedOpsAlarmName),
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
 
-	// Create CloudWatch dashboard
-	dashboardBody := replicationGroupId.ApplyT(func(rgId string) string {
-		return fmt.Sprintf(`{
-			"widgets": [
-				{
-					"type": "text",
-					"x": 0,
-					"y": 0,
-					"width": 24,
-					"height": 1,
-					"properties": {
-						"markdown": "# Lettuce Failover Lab Dashboard"
-					}
-				},
-				{
-					"type": "metric",
-					"x": 0,
-					"y": 1,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "ElastiCache - Replication Lag",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["AWS/ElastiCache", "ReplicationLag", "CacheClusterId", "%s-0001-001", {"label": "Shard 1 Replica"}],
-							["AWS/ElastiCache", "ReplicationLag", "CacheClusterId", "%s-0002-001", {"label": "Shard 2 Replica"}],
-							["AWS/ElastiCache", "ReplicationLag", "CacheClusterId", "%s-0003-001", {"label": "Shard 3 Replica"}]
-						],
-						"region": "us-east-1",
-						"period": 60
-					}
-				},
-				{
-					"type": "metric",
-					"x": 8,
-					"y": 1,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "ElastiCache - Current Connections",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["AWS/ElastiCache", "CurrConnections", "CacheClusterId", "%s-0001-001", {"label": "Shard 1 Primary"}],
-							["AWS/ElastiCache", "CurrConnections", "CacheClusterId", "%s-0002-001", {"label": "Shard 2 Primary"}],
-							["AWS/ElastiCache", "CurrConnections", "CacheClusterId", "%s-0003-001", {"label": "Shard 3 Primary"}]
-						],
-						"region": "us-east-1",
-						"period": 60
-					}
-				},
-				{
-					"type": "metric",
-					"x": 16,
-					"y": 1,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "ElastiCache - CPU Utilization",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["AWS/ElastiCache", "CPUUtilization", "CacheClusterId", "%s-0001-001", {"label": "Shard 1"}],
-							["AWS/ElastiCache", "CPUUtilization", "CacheClusterId", "%s-0002-001", {"label": "Shard 2"}],
-							["AWS/ElastiCache", "CPUUtilization", "CacheClusterId", "%s-0003-001", {"label": "Shard 3"}]
-						],
-						"region": "us-east-1",
-						"period": 60
-					}
-				},
-				{
-					"type": "metric",
-					"x": 0,
-					"y": 7,
-					"width": 12,
-					"height": 6,
-					"properties": {
-						"title": "Application - Failover Metrics",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["RedisFailoverLab", "connection.drop.duration.ms", {"label": "Connection Drop Duration"}],
-							["RedisFailoverLab", "topology.refresh.count", {"label": "Topology Refresh Count"}],
-							["RedisFailoverLab", "operations.failed.during.failover", {"label": "Failed Operations"}]
-						],
-						"region": "us-east-1",
-						"period": 10
-					}
-				},
-				{
-					"type": "metric",
-					"x": 12,
-					"y": 7,
-					"width": 12,
-					"height": 6,
-					"properties": {
-						"title": "Application - Operation Latency",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["RedisFailoverLab", "operations.latency.p50.ms", {"label": "P50 Latency"}],
-							["RedisFailoverLab", "operations.latency.p99.ms", {"label": "P99 Latency"}],
-							["RedisFailoverLab", "operations.latency.max.ms", {"label": "Max Latency"}]
-						],
-						"region": "us-east-1",
-						"period": 10
-					}
-				},
-				{
-					"type": "metric",
-					"x": 0,
-					"y": 13,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "Pub/Sub Metrics",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["RedisFailoverLab", "pubsub.messages.published", {"label": "Published"}],
-							["RedisFailoverLab", "pubsub.messages.received", {"label": "Received"}],
-							["RedisFailoverLab", "pubsub.message.loss.count", {"label": "Lost"}]
-						],
-						"region": "us-east-1",
-						"period": 10
-					}
-				},
-				{
-					"type": "metric",
-					"x": 8,
-					"y": 13,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "Streams Metrics",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["RedisFailoverLab", "streams.messages.added", {"label": "Added"}],
-							["RedisFailoverLab", "streams.messages.consumed", {"label": "Consumed"}],
-							["RedisFailoverLab", "streams.lag.ms", {"label": "Lag (ms)"}]
-						],
-						"region": "us-east-1",
-						"period": 10
-					}
-				},
-				{
-					"type": "metric",
-					"x": 16,
-					"y": 13,
-					"width": 8,
-					"height": 6,
-					"properties": {
-						"title": "GET/SET Operations",
-						"view": "timeSeries",
-						"stacked": false,
-						"metrics": [
-							["RedisFailoverLab", "getset.operations.success", {"label": "Success"}],
-							["RedisFailoverLab", "getset.operations.failed", {"label": "Failed"}],
-							["RedisFailoverLab", "getset.sequence.gaps", {"label": "Sequence Gaps"}]
-						],
-						"region": "us-east-1",
-						"period": 10
-					}
-				}
-			]
-		}`, rgId, rgId, rgId, rgId, rgId, rgId, rgId, rgId, rgId)
+	var shardAlarms *shardAlarmsResult
+	if cfg.ShardAlarms {
+		shardAlarms, err = createShardAlarms(ctx, awsProvider, cfg, replicationGroupId, shardReplicas, alarmTopic.Arn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create CloudWatch dashboard, looking up node placement only when grouping by AZ
+	nodeAzs := pulumi.StringMap{}.ToStringMapOutput()
+	if cfg.DashboardGrouping == "by-az" {
+		nodeAzs = lookupNodeAzs(ctx, awsProvider, replicationGroupId, shardReplicas)
+	}
+	// An empty cluster name leaves the EKS panels out
+	dashboardEksCluster := pulumi.String("").ToStringOutput()
+	if cfg.IncludeEksWidgets {
+		dashboardEksCluster = source.EksClusterName
+	}
+	dashboardInputs := pulumi.All(replicationGroupId, nodeAzs, dashboardEksCluster)
+	resolved := func(args []interface{}) dashboardOutputs {
+		return dashboardOutputs{
+			replicationGroupId: args[0].(string),
+			nodeAzs:            args[1].(map[string]string),
+			eksClusterName:     args[2].(string),
+			runId:              source.RunId,
+		}
+	}
+	dashboardBody := dashboardInputs.ApplyT(func(args []interface{}) (string, error) {
+		return cloudwatchDashboardJSON(cfg, resolved(args))
 	}).(pulumi.StringOutput)
 
 	dashboard, err := cloudwatch.NewDashboard(ctx, "redis-failover-lab-dashboard", &cloudwatch.DashboardArgs{
-		DashboardName: pulumi.String("RedisFailoverLab-Dashboard"),
+		DashboardName: pulumi.String(dashboardName),
 		DashboardBody: dashboardBody,
-	})
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	result.DashboardArn = dashboard.DashboardArn
+	result.AlarmTopicArn = alarmTopic.Arn
+	result.FailedOpsAlarmArn = failedOpsAlarm.Arn
+	if shardAlarms != nil {
+		result.ShardAlarmArns = shardAlarms.shardArns
+		result.ShardsAlarmArn = shardAlarms.overallArn
+	}
+
+	// Mirror the same widgets as a Grafana dashboard for the CloudWatch datasource
+	if cfg.EmitGrafanaDashboard {
+		result.GrafanaDashboard = dashboardInputs.ApplyT(func(args []interface{}) (string, error) {
+			return grafanaDashboardJSON(cfg, resolved(args))
+		}).(pulumi.StringOutput)
+	}
+	return result, nil
+}
+
+// shardAlarmMetrics are the per-shard child alarms: the metric, alarmed on the
+// largest value across the shard's members, and its threshold
+var shardAlarmMetrics = []struct {
+	alarm      string
+	metricName string
+	threshold  float64
+}{
+	{"redis-cpu", "EngineCPUUtilization", 90},
+	{"redis-memory", "DatabaseMemoryUsagePercentage", 80},
+	// Seconds; only replicas report it, so the member that is primary adds no data
+	{"redis-replication-lag", "ReplicationLag", 5},
+}
+
+type shardAlarmsResult struct {
+	shardArns  pulumi.StringMap
+	overallArn pulumi.StringOutput
+}
+
+// createShardAlarms creates the shardAlarmMetrics alarms of every shard, a composite
+// per shard over only that shard's alarms and one composite over the shard
+// composites. The child alarms have no actions so a failing shard notifies
+// alarmTopicArn once, through its composite
+func createShardAlarms(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, replicationGroupId pulumi.StringOutput, shardReplicas []int, alarmTopicArn pulumi.StringOutput) (*shardAlarmsResult, error) {
+	shardArns := pulumi.StringMap{}
+	var compositeArns pulumi.StringArray
+	for shard := 1; shard <= numShards; shard++ {
+		var members []string
+		for _, node := range nodeSuffixes(shardReplicas) {
+			if strings.HasPrefix(node, fmt.Sprintf("%04d-", shard)) {
+				members = append(members, node)
+			}
+		}
+
+		var childArns pulumi.StringArray
+		for _, metric := range shardAlarmMetrics {
+			queries := cloudwatch.MetricAlarmMetricQueryArray{}
+			ids := make([]string, len(members))
+			for i, node := range members {
+				ids[i] = fmt.Sprintf("m%d", i+1)
+				queries = append(queries, &cloudwatch.MetricAlarmMetricQueryArgs{
+					Id: pulumi.String(ids[i]),
+					Metric: &cloudwatch.MetricAlarmMetricQueryMetricArgs{
+						Namespace:  pulumi.String("AWS/ElastiCache"),
+						MetricName: pulumi.String(metric.metricName),
+						Dimensions: pulumi.StringMap{
+							"CacheClusterId": pulumi.Sprintf("%s-%s", replicationGroupId, node),
+							"CacheNodeId":    pulumi.String("0001"),
+						},
+						Period: pulumi.Int(60),
+						Stat:   pulumi.String("Maximum"),
+					},
+				})
+			}
+			queries = append(queries, &cloudwatch.MetricAlarmMetricQueryArgs{
+				Id:         pulumi.String("shard"),
+				Expression: pulumi.String(fmt.Sprintf("MAX([%s])", strings.Join(ids, ", "))),
+				Label:      pulumi.String(fmt.Sprintf("Shard %d %s", shard, metric.metricName)),
+				ReturnData: pulumi.Bool(true),
+			})
+
+			alarmName := cfg.alarmName(metric.alarm, shard)
+			alarm, err := cloudwatch.NewMetricAlarm(ctx, fmt.Sprintf("redis-failover-lab-%s-shard%d", metric.alarm, shard), &cloudwatch.MetricAlarmArgs{
+				Name:               pulumi.String(alarmName),
+				AlarmDescription:   pulumi.String(fmt.Sprintf("%s of a shard %d member exceeded %g", metric.metricName, shard, metric.threshold)),
+				MetricQueries:      queries,
+				EvaluationPeriods:  pulumi.Int(3),
+				Threshold:          pulumi.Float64(metric.threshold),
+				ComparisonOperator: pulumi.String("GreaterThanThreshold"),
+				TreatMissingData:   pulumi.String("notBreaching"),
+				Tags:               alarmTags(ctx, alarmName),
+			}, pulumi.Provider(awsProvider))
+			if err != nil {
+				return nil, err
+			}
+			childArns = append(childArns, alarm.Arn)
+		}
+
+		alarmName := cfg.alarmName("redis", shard)
+		alarm, err := cloudwatch.NewCompositeAlarm(ctx, fmt.Sprintf("redis-failover-lab-redis-shard%d", shard), &cloudwatch.CompositeAlarmArgs{
+			AlarmName:        pulumi.String(alarmName),
+			AlarmDescription: pulumi.String(fmt.Sprintf("Shard %d is unhealthy", shard)),
+			AlarmRule:        anyAlarmRule(childArns),
+			AlarmActions:     pulumi.StringArray{alarmTopicArn},
+			OkActions:        pulumi.StringArray{alarmTopicArn},
+			Tags:             alarmTags(ctx, alarmName),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		shardArns[fmt.Sprintf("shard%d", shard)] = alarm.Arn
+		compositeArns = append(compositeArns, alarm.Arn)
+	}
+
+	alarmName := cfg.alarmName("redis-shards", 0)
+	alarm, err := cloudwatch.NewCompositeAlarm(ctx, "redis-failover-lab-redis-shards", &cloudwatch.CompositeAlarmArgs{
+		AlarmName:        pulumi.String(alarmName),
+		AlarmDescription: pulumi.String("A Redis shard is unhealthy"),
+		AlarmRule:        anyAlarmRule(compositeArns),
+		AlarmActions:     pulumi.StringArray{alarmTopicArn},
+		OkActions:        pulumi.StringArray{alarmTopicArn},
+		Tags:             alarmTags(ctx, alarmName),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &shardAlarmsResult{
+		shardArns:  shardArns,
+		overallArn: alarm.Arn,
+	}, nil
+}
+
+// anyAlarmRule returns a composite alarm rule in ALARM when any of alarmArns is
+func anyAlarmRule(alarmArns pulumi.StringArray) pulumi.StringOutput {
+	return alarmArns.ToStringArrayOutput().ApplyT(func(arns []string) string {
+		terms := make([]string, len(arns))
+		for i, arn := range arns {
+			terms[i] = fmt.Sprintf("ALARM(%q)", arn)
+		}
+		return strings.Join(terms, " OR ")
+	}).(pulumi.StringOutput)
+}
+
+// lookupNodeAzs returns the AZ of every node of the replication group keyed by its
+// shard/node suffix (0001-001), as placed at creation. The per-node lookups are
+// independent outputs collected into one map, so they all run in parallel once the
+// replication group ID resolves
+func lookupNodeAzs(ctx *pulumi.Context, awsProvider *aws.Provider, replicationGroupId pulumi.StringOutput, shardReplicas []int) pulumi.StringMapOutput {
+	nodeAzs := pulumi.StringMap{}
+	for _, node := range nodeSuffixes(shardReplicas) {
+		nodeAzs[node] = elasticache.LookupClusterOutput(ctx, elasticache.LookupClusterOutputArgs{
+			ClusterId: pulumi.Sprintf("%s-%s", replicationGroupId, node),
+		}, pulumi.Provider(awsProvider)).AvailabilityZone()
+	}
+	return nodeAzs.ToStringMapOutput()
+}
+
+// CreateLabHealthAlarm creates a composite alarm that fires when any of alarmArns is in
+// ALARM, giving one signal that the lab environment (not Redis) is unhealthy
+func CreateLabHealthAlarm(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, alarmArns pulumi.StringArray, alarmTopicArn pulumi.StringOutput) (*LabHealthAlarmResult, error) {
+	alarmName := cfg.alarmName("health", 0)
+	alarm, err := cloudwatch.NewCompositeAlarm(ctx, "redis-failover-lab-health", &cloudwatch.CompositeAlarmArgs{
+		AlarmName:        pulumi.String(alarmName),
+		AlarmDescription: pulumi.String("Lab environment is unhealthy - failover results may be invalid"),
+		AlarmRule:        anyAlarmRule(alarmArns),
+		AlarmActions:     pulumi.StringArray{alarmTopicArn},
+		OkActions:        pulumi.StringArray{alarmTopicArn},
+		Tags:             alarmTags(ctx, alarmName),
+	}, pulumi.Provider(awsProvider))
 	if err != nil {
 		return nil, err
 	}
 
-	return &MonitoringResult{
-		DashboardArn: dashboard.DashboardArn,
-		LogGroupArn:  logGroup.Arn,
+	return &LabHealthAlarmResult{
+		AlarmArn: alarm.Arn,
 	}, nil
 }
@@ -0,0 +1,280 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// nodeReplacementSource replaces the primary of one shard with a new node: TestFailover
+// demotes it, then DecreaseReplicaCount removes it and IncreaseReplicaCount adds a
+// fresh replica. Cluster mode reports no node roles, so the primary is the member
+// whose IsMaster metric last read 1; the replacement is refused until one has, and
+// while any member is unavailable. Multi-AZ needs a replica per shard, so a shard
+// with only one replica gets the new replica before the old node is removed. Each
+// step waits for the shard to settle; when the invocation runs short, the function
+// invokes itself asynchronously with the remaining steps
+const nodeReplacementSource = `import json
+import time
+from datetime import datetime, timedelta, timezone
+
+import boto3
+
+elasticache = boto3.client("elasticache")
+cloudwatch = boto3.client("cloudwatch")
+lambda_client = boto3.client("lambda")
+
+# Hand the remaining steps to a new invocation when less than this is left
+WAIT_BUDGET_MS = 60000
+
+
+def group(group_id):
+    return elasticache.describe_replication_groups(ReplicationGroupId=group_id)["ReplicationGroups"][0]
+
+
+def members(group_id, shard):
+    return sorted(
+        member["CacheClusterId"]
+        for node_group in group(group_id)["NodeGroups"] if node_group["NodeGroupId"] == shard
+        for member in node_group["NodeGroupMembers"]
+    )
+
+
+def status(cluster_id):
+    return elasticache.describe_cache_clusters(CacheClusterId=cluster_id)["CacheClusters"][0]["CacheClusterStatus"]
+
+
+def is_master(cluster_id):
+    end = datetime.now(timezone.utc)
+    values = cloudwatch.get_metric_data(
+        MetricDataQueries=[{
+            "Id": "m",
+            "MetricStat": {
+                "Metric": {
+                    "Namespace": "AWS/ElastiCache",
+                    "MetricName": "IsMaster",
+                    "Dimensions": [
+                        {"Name": "CacheClusterId", "Value": cluster_id},
+                        {"Name": "CacheNodeId", "Value": "0001"},
+                    ],
+                },
+                "Period": 60,
+                "Stat": "Maximum",
+            },
+        }],
+        StartTime=end - timedelta(minutes=10),
+        EndTime=end,
+    )["MetricDataResults"][0]["Values"]
+    return values[0] == 1 if values else None
+
+
+def settled(group_id, shard):
+    return group(group_id)["Status"] == "available" and all(
+        status(member) == "available" for member in members(group_id, shard))
+
+
+def handler(event, context):
+    group_id = event["replicationGroupId"]
+    shard = "%04d" % event["shard"]
+    state = event.get("state")
+    if state is None:
+        before = members(group_id, shard)
+        down = [member for member in before if status(member) != "available"]
+        if down:
+            raise Exception("shard %s has members not available: %s" % (shard, ", ".join(down)))
+        primaries = [member for member in before if is_master(member)]
+        if not primaries:
+            raise Exception("shard %s has no member reporting IsMaster yet; retry once metrics arrive" % shard)
+        multi_az = group(group_id).get("MultiAZ") == "enabled"
+        steps = ["remove", "add"] if len(before) > 2 or not multi_az else ["add", "remove"]
+        elasticache.test_failover(ReplicationGroupId=group_id, NodeGroupId=shard)
+        state = {"old": primaries[0], "before": before, "steps": steps}
+
+    while True:
+        # Modifications take a moment to show in the statuses
+        time.sleep(30)
+        while not settled(group_id, shard):
+            if context.get_remaining_time_in_millis() < WAIT_BUDGET_MS:
+                lambda_client.invoke(
+                    FunctionName=context.invoked_function_arn,
+                    InvocationType="Event",
+                    Payload=json.dumps(dict(event, state=state)),
+                )
+                return {"memberClusterId": state["old"], "shard": shard, "status": "replacing", "pending": state["steps"]}
+            time.sleep(15)
+        if not state["steps"]:
+            break
+        step = state["steps"].pop(0)
+        if step == "remove":
+            elasticache.decrease_replica_count(
+                ReplicationGroupId=group_id, ReplicasToRemove=[state["old"]], ApplyImmediately=True)
+        else:
+            elasticache.increase_replica_count(
+                ReplicationGroupId=group_id,
+                ReplicaConfiguration=[{"NodeGroupId": shard, "NewReplicaCount": len(members(group_id, shard))}],
+                ApplyImmediately=True,
+            )
+
+    # The new node may take over the removed node's ID
+    added = sorted(set(members(group_id, shard)) - set(state["before"]))
+    return {
+        "memberClusterId": state["old"],
+        "replacementMemberClusterId": added[0] if added else state["old"],
+        "shard": shard,
+        "status": "replaced",
+    }
+`
+
+type NodeReplacementResult struct {
+	// MemberClusterId is the replaced primary member cluster
+	MemberClusterId pulumi.StringOutput
+	// ReplacementMemberClusterId is the new node, empty until the replacement is done
+	ReplacementMemberClusterId pulumi.StringOutput
+	// Result is {memberClusterId, replacementMemberClusterId, shard, status}, status
+	// being replacing, with the pending steps, if they outlast the invocation
+	Result pulumi.MapOutput
+}
+
+// SimulateNodeReplacement replaces the primary of shard cfg.NodeReplacementShard with
+// a new node, through a failover, the removal of the old node and a new replica. It
+// runs on create and again whenever the shard or cfg.NodeReplacementRunId changes; a
+// refused replacement fails pulumi up
+func SimulateNodeReplacement(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig, clusterKey string, redis *ElastiCacheResult) (*NodeReplacementResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-node-replacement-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-node-replacement-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-node-replacement-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	// Like the deploy failover, scoped to the replication group and its member clusters;
+	// GetMetricData has no resource-level permissions
+	replacementPolicy, err := iam.NewRolePolicy(ctx, prefix+"-node-replacement-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: redis.ReplicationGroupArn.ApplyT(func(arn string) (string, error) {
+			clusterArns := strings.Replace(arn, ":replicationgroup:", ":cluster:", 1) + "-*"
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect": "Allow",
+						"Action": []string{
+							"elasticache:DescribeReplicationGroups",
+							"elasticache:TestFailover",
+							"elasticache:IncreaseReplicaCount",
+							"elasticache:DecreaseReplicaCount",
+						},
+						"Resource": []string{arn, clusterArns},
+					},
+					{
+						"Effect":   "Allow",
+						"Action":   "elasticache:DescribeCacheClusters",
+						"Resource": clusterArns,
+					},
+					{
+						"Effect":   "Allow",
+						"Action":   "cloudwatch:GetMetricData",
+						"Resource": "*",
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-node-replacement", &lambda.FunctionArgs{
+		Description: pulumi.String("Replaces the primary of a Failover Lab shard with a new node"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(900),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(nodeReplacementSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-node-replacement"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, replacementPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps that outlast one invocation continue in the next
+	continuePolicy, err := iam.NewRolePolicy(ctx, prefix+"-node-replacement-continue-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: function.Arn.ApplyT(func(arn string) (string, error) {
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect":   "Allow",
+						"Action":   "lambda:InvokeFunction",
+						"Resource": arn,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := redis.ReplicationGroupId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"replicationGroupId": id,
+			"shard":              cfg.NodeReplacementShard,
+			"runId":              cfg.NodeReplacementRunId,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	invocation, err := lambda.NewInvocation(ctx, prefix+"-node-replacement", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.DependsOn([]pulumi.Resource{continuePolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	result := invocation.Result.ApplyT(func(result string) (map[string]interface{}, error) {
+		var status map[string]interface{}
+		err := json.Unmarshal([]byte(result), &status)
+		return status, err
+	}).(pulumi.MapOutput)
+	return &NodeReplacementResult{
+		MemberClusterId: result.ApplyT(func(status map[string]interface{}) string {
+			id, _ := status["memberClusterId"].(string)
+			return id
+		}).(pulumi.StringOutput),
+		ReplacementMemberClusterId: result.ApplyT(func(status map[string]interface{}) string {
+			id, _ := status["replacementMemberClusterId"].(string)
+			return id
+		}).(pulumi.StringOutput),
+		Result: result,
+	}, nil
+}
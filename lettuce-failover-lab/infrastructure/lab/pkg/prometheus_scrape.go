@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// cloudwatchExporterMetrics are the ElastiCache metrics that show a failover
+var cloudwatchExporterMetrics = []struct {
+	name      string
+	statistic string
+}{
+	{"CPUUtilization", "Average"},
+	{"EngineCPUUtilization", "Average"},
+	{"CurrConnections", "Maximum"},
+	{"NewConnections", "Sum"},
+	{"ReplicationLag", "Maximum"},
+	{"IsMaster", "Maximum"},
+}
+
+type PrometheusScrapeConfigResult struct {
+	ParameterName pulumi.StringOutput
+}
+
+// prometheusScrapeConfigJSON renders the Prometheus scrape jobs for redis_exporter and
+// cloudwatch_exporter, and a cloudwatch_exporter config for the lab's nodes. Both are
+// JSON, which Prometheus and cloudwatch_exporter read as YAML
+func prometheusScrapeConfigJSON(region, replicationGroupId string, shardReplicas []int) (string, error) {
+	var cacheClusterIds []string
+	for _, node := range nodeSuffixes(shardReplicas) {
+		cacheClusterIds = append(cacheClusterIds, fmt.Sprintf("%s-%s", replicationGroupId, node))
+	}
+
+	var metrics []map[string]interface{}
+	for _, metric := range cloudwatchExporterMetrics {
+		metrics = append(metrics, map[string]interface{}{
+			"aws_namespace":        "AWS/ElastiCache",
+			"aws_metric_name":      metric.name,
+			"aws_dimensions":       []string{"CacheClusterId", "CacheNodeId"},
+			"aws_dimension_select": map[string][]string{"CacheClusterId": cacheClusterIds},
+			"aws_statistics":       []string{metric.statistic},
+		})
+	}
+
+	job := func(name, service string, port int, interval string) map[string]interface{} {
+		target := fmt.Sprintf("%s.%s.svc.cluster.local:%d", service, observabilityNamespace, port)
+		return map[string]interface{}{
+			"job_name":        name,
+			"scrape_interval": interval,
+			"static_configs":  []map[string][]string{{"targets": {target}}},
+		}
+	}
+
+	bytes, err := json.Marshal(map[string]interface{}{
+		"prometheus": map[string]interface{}{
+			"scrape_configs": []map[string]interface{}{
+				job("redis-exporter", "redis-exporter", 9121, "10s"),
+				// CloudWatch publishes at 1-minute resolution at best
+				job("cloudwatch-exporter", "cloudwatch-exporter", 9106, "60s"),
+			},
+		},
+		"cloudwatchExporter": map[string]interface{}{
+			"region":  region,
+			"metrics": metrics,
+		},
+	})
+	return string(bytes), err
+}
+
+// ExportPrometheusScrapeConfig writes ready-to-use redis_exporter and
+// cloudwatch_exporter configuration for the lab to an SSM parameter, so existing
+// Prometheus setups can pick up the lab's metrics. Exporter targets assume the
+// observability namespace; the region is the stack's
+func ExportPrometheusScrapeConfig(ctx *pulumi.Context, awsProvider *aws.Provider, replicationGroupId pulumi.StringOutput, shardReplicas []int) (*PrometheusScrapeConfigResult, error) {
+	region, err := aws.GetRegion(ctx, nil, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	scrapeConfig := replicationGroupId.ApplyT(func(rgId string) (string, error) {
+		return prometheusScrapeConfigJSON(region.Name, rgId, shardReplicas)
+	}).(pulumi.StringOutput)
+
+	// Intelligent-Tiering moves to the advanced tier only if the config outgrows 4 KB
+	parameter, err := ssm.NewParameter(ctx, "redis-failover-lab-prometheus-scrape-config", &ssm.ParameterArgs{
+		Name:        pulumi.String("/redis-failover-lab/prometheus/scrape-config"),
+		Description: pulumi.String("redis_exporter and cloudwatch_exporter scrape configuration for the Failover Lab"),
+		Type:        pulumi.String("String"),
+		Tier:        pulumi.String("Intelligent-Tiering"),
+		Value:       scrapeConfig,
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-prometheus-scrape-config"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrometheusScrapeConfigResult{
+		ParameterName: parameter.Name,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	helmv3 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// prometheusStackRelease names the Helm release; the chart derives service names from it
+const prometheusStackRelease = "kube-prometheus-stack"
+
+type PrometheusStackResult struct {
+	GrafanaService     pulumi.StringOutput
+	GrafanaAdminSecret pulumi.StringOutput
+}
+
+// prometheusFailoverDashboardJSON renders a Grafana dashboard of redis_exporter
+// metrics for the Prometheus datasource the chart provisions
+func prometheusFailoverDashboardJSON() (string, error) {
+	panel := func(id, x, y int, title, expr string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":         id,
+			"type":       "timeseries",
+			"title":      title,
+			"gridPos":    map[string]int{"x": x, "y": y, "w": 12, "h": 8},
+			"datasource": map[string]string{"type": "prometheus", "uid": "prometheus"},
+			"targets": []map[string]string{
+				{"refId": "A", "expr": expr, "legendFormat": "{{instance}}"},
+			},
+		}
+	}
+
+	dashboard := map[string]interface{}{
+		"title":         "Lettuce Failover Lab - Redis",
+		"uid":           "redis-failover-lab-prometheus",
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-1h", "to": "now"},
+		"panels": []map[string]interface{}{
+			panel(1, 0, 0, "Exporter Up (0 during failover)", "redis_up"),
+			panel(2, 12, 0, "Connected Clients", "redis_connected_clients"),
+			panel(3, 0, 8, "Commands per Second", "rate(redis_commands_processed_total[1m])"),
+			panel(4, 12, 8, "Connected Replicas", "redis_connected_slaves"),
+		},
+	}
+	bytes, err := json.Marshal(dashboard)
+	return string(bytes), err
+}
+
+// DeployPrometheusStack installs kube-prometheus-stack into namespace, scraping the
+// redis-exporter service and provisioning a failover dashboard in its Grafana
+// An in-cluster alternative to the CloudWatch dashboard; requires DeployRedisExporter
+func DeployPrometheusStack(ctx *pulumi.Context, provider *kubernetes.Provider, namespace *corev1.Namespace) (*PrometheusStackResult, error) {
+	dashboardJSON, err := prometheusFailoverDashboardJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// Picked up by the Grafana dashboard sidecar, which watches for this label
+	_, err = corev1.NewConfigMap(ctx, "redis-failover-lab-grafana-dashboard", &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-failover-lab-grafana-dashboard"),
+			Namespace: namespace.Metadata.Name(),
+			Labels: pulumi.StringMap{
+				"grafana_dashboard":         pulumi.String("1"),
+				"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+			},
+		},
+		Data: pulumi.StringMap{
+			"redis-failover-lab.json": pulumi.String(dashboardJSON),
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	exporterTarget := fmt.Sprintf("redis-exporter.%s.svc.cluster.local:9121", observabilityNamespace)
+	release, err := helmv3.NewRelease(ctx, prometheusStackRelease, &helmv3.ReleaseArgs{
+		Name:      pulumi.String(prometheusStackRelease),
+		Chart:     pulumi.String("kube-prometheus-stack"),
+		Version:   pulumi.String("65.1.1"),
+		Namespace: namespace.Metadata.Name(),
+		RepositoryOpts: &helmv3.RepositoryOptsArgs{
+			Repo: pulumi.String("https://prometheus-community.github.io/helm-charts"),
+		},
+		Values: pulumi.Map{
+			"prometheus": pulumi.Map{
+				"prometheusSpec": pulumi.Map{
+					"additionalScrapeConfigs": pulumi.Array{
+						pulumi.Map{
+							"job_name":        pulumi.String("redis-exporter"),
+							"scrape_interval": pulumi.String("10s"),
+							"static_configs": pulumi.Array{
+								pulumi.Map{"targets": pulumi.StringArray{pulumi.String(exporterTarget)}},
+							},
+						},
+					},
+				},
+			},
+			"grafana": pulumi.Map{
+				"sidecar": pulumi.Map{
+					"dashboards": pulumi.Map{
+						"enabled":         pulumi.Bool(true),
+						"label":           pulumi.String("grafana_dashboard"),
+						"searchNamespace": pulumi.String("ALL"),
+					},
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrometheusStackResult{
+		GrafanaService:     pulumi.Sprintf("%s-grafana.%s.svc.cluster.local:80", prometheusStackRelease, release.Status.Namespace().Elem()),
+		GrafanaAdminSecret: pulumi.Sprintf("%s/%s-grafana", release.Status.Namespace().Elem(), prometheusStackRelease),
+	}, nil
+}
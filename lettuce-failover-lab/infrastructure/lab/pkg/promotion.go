@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// promotionOutcome is what happens to one shard when one AZ fails
+// Outcome is unaffected (primary outside the AZ), failover (a candidate replica is
+// promoted), unavailable (no replica outside the AZ) or unknown (no primary known)
+type promotionOutcome struct {
+	Outcome string
+	// Primary is the primary after the failure, when known
+	Primary string
+	// Candidates are the replicas ElastiCache may promote; it picks the one with the
+	// least replication lag, so a single candidate is the only deterministic case
+	Candidates   []string
+	LostReplicas []string
+}
+
+// expectedPromotionOrder derives, for the failure of each AZ holding a node, the
+// outcome for every shard from nodeAzs (AZ by shard/node suffix, 0001-001, ...)
+// ElastiCache has no per-replica promotion priority, so placement is all there is
+// to predict from. primaries gives each shard's current primary node; a shard
+// missing from it has an unknown outcome
+// Warnings name each AZ whose failure leaves a shard without a replica to promote
+func expectedPromotionOrder(nodeAzs, primaries map[string]string) (map[string]map[string]promotionOutcome, []string) {
+	shards := map[string][]string{}
+	azSet := map[string]bool{}
+	for node, az := range nodeAzs {
+		shard := strings.SplitN(node, "-", 2)[0]
+		shards[shard] = append(shards[shard], node)
+		azSet[az] = true
+	}
+	var azs []string
+	for az := range azSet {
+		azs = append(azs, az)
+	}
+	sort.Strings(azs)
+
+	order := map[string]map[string]promotionOutcome{}
+	var warnings []string
+	for _, failedAz := range azs {
+		outcomes := map[string]promotionOutcome{}
+		for shard, nodes := range shards {
+			primary, ok := primaries[shard]
+			if !ok {
+				outcomes[shard] = promotionOutcome{Outcome: "unknown"}
+				continue
+			}
+			sort.Strings(nodes)
+			var survivors, lost []string
+			for _, replica := range nodes {
+				if replica == primary {
+					continue
+				}
+				if nodeAzs[replica] == failedAz {
+					lost = append(lost, replica)
+				} else {
+					survivors = append(survivors, replica)
+				}
+			}
+
+			outcome := promotionOutcome{LostReplicas: lost}
+			switch {
+			case nodeAzs[primary] != failedAz:
+				outcome.Outcome = "unaffected"
+				outcome.Primary = primary
+			case len(survivors) == 0:
+				outcome.Outcome = "unavailable"
+				warnings = append(warnings, fmt.Sprintf("shard %s has no replica outside %s", shard, failedAz))
+			default:
+				outcome.Outcome = "failover"
+				outcome.Candidates = survivors
+				if len(survivors) == 1 {
+					outcome.Primary = survivors[0]
+				}
+			}
+			outcomes[shard] = outcome
+		}
+		order[failedAz] = outcomes
+	}
+	sort.Strings(warnings)
+	return order, warnings
+}
+
+// ExpectedPromotionOrder exports, per AZ, the expected primary of each shard of the
+// cluster after that AZ fails, from the placement of its nodes and the current
+// primaries as of this update
+func ExpectedPromotionOrder(ctx *pulumi.Context, awsProvider *aws.Provider, redis *ElastiCacheResult) pulumi.MapOutput {
+	nodeAzs := lookupNodeAzs(ctx, awsProvider, redis.ReplicationGroupId, redis.ShardReplicas)
+	return pulumi.All(nodeAzs, redis.ShardPrimaries).ApplyT(func(args []interface{}) map[string]interface{} {
+		order, warnings := expectedPromotionOrder(args[0].(map[string]string), args[1].(map[string]string))
+		byAz := map[string]interface{}{}
+		for az, outcomes := range order {
+			shards := map[string]interface{}{}
+			for shard, outcome := range outcomes {
+				entry := map[string]interface{}{"outcome": outcome.Outcome}
+				if outcome.Primary != "" {
+					entry["primary"] = outcome.Primary
+				}
+				if len(outcome.Candidates) > 0 {
+					entry["candidates"] = outcome.Candidates
+				}
+				if len(outcome.LostReplicas) > 0 {
+					entry["lostReplicas"] = outcome.LostReplicas
+				}
+				shards[shard] = entry
+			}
+			byAz[az] = shards
+		}
+		if warnings == nil {
+			warnings = []string{}
+		}
+		return map[string]interface{}{
+			"azFailure": byAz,
+			"warnings":  warnings,
+		}
+	}).(pulumi.MapOutput)
+}
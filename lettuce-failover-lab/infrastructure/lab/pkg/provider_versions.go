@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// providerModules maps each providerVersion key to the SDK module of the provider.
+// Each SDK registers its resources with its own version, so the module version go.mod
+// resolves is the plugin version the engine loads
+var providerModules = map[string]string{
+	"aws": "github.com/pulumi/pulumi-aws/sdk/v6",
+	"eks": "github.com/pulumi/pulumi-eks/sdk/v2",
+}
+
+// ProviderVersions returns the provider plugin versions this program was built
+// against, keyed like providerVersion, e.g. aws: 6.56.1
+func ProviderVersions() (map[string]string, error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil, fmt.Errorf("providerVersion: build info unavailable, cannot tell the provider versions")
+	}
+	versions := map[string]string{}
+	for _, dep := range info.Deps {
+		// A replace directive points the module at another version or a local copy
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		for key, path := range providerModules {
+			if dep.Path == path {
+				versions[key] = strings.TrimPrefix(dep.Version, "v")
+			}
+		}
+	}
+	return versions, nil
+}
+
+// ValidateProviderVersions fails unless every version pinned in cfg.ProviderVersion
+// is the one the program runs with, so results compared months apart come from the
+// same providers; a pin is changed together with go.mod, never silently
+func ValidateProviderVersions(cfg *LabConfig) error {
+	if len(cfg.ProviderVersion) == 0 {
+		return nil
+	}
+	versions, err := ProviderVersions()
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for key, pinned := range cfg.ProviderVersion {
+		if versions[key] != pinned {
+			problems = append(problems, fmt.Sprintf("%s pinned to %s but the program uses %s (go get %s@v%s)",
+				key, pinned, versions[key], providerModules[key], pinned))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("providerVersion: %s", strings.Join(problems, "; "))
+}
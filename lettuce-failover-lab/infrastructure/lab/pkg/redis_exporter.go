@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	appsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type RedisExporterResult struct {
+	ServiceName pulumi.StringOutput
+}
+
+// DeployRedisExporter runs oliver006/redis_exporter against the cluster configuration
+// endpoint, exposing INFO-derived server metrics for Prometheus on port 9121
+// The lab cluster has no auth token, so the exporter needs no password; it connects
+// over rediss:// when tls is set, as with in-transit encryption
+func DeployRedisExporter(ctx *pulumi.Context, provider *kubernetes.Provider, namespace *corev1.Namespace, redisEndpoint pulumi.StringOutput, tls bool) (*RedisExporterResult, error) {
+	scheme := "redis"
+	if tls {
+		scheme = "rediss"
+	}
+
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name":    pulumi.String("redis-exporter"),
+		"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+	}
+
+	_, err := appsv1.NewDeployment(ctx, "redis-exporter", &appsv1.DeploymentArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-exporter"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Spec: &appsv1.DeploymentSpecArgs{
+			Replicas: pulumi.Int(1),
+			Selector: &metav1.LabelSelectorArgs{
+				MatchLabels: labels,
+			},
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: labels,
+					Annotations: pulumi.StringMap{
+						"prometheus.io/scrape": pulumi.String("true"),
+						"prometheus.io/port":   pulumi.String("9121"),
+					},
+				},
+				Spec: &corev1.PodSpecArgs{
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:  pulumi.String("redis-exporter"),
+							Image: pulumi.String("oliver006/redis_exporter:v1.62.0"),
+							Ports: corev1.ContainerPortArray{
+								&corev1.ContainerPortArgs{
+									Name:          pulumi.String("metrics"),
+									ContainerPort: pulumi.Int(9121),
+								},
+							},
+							Env: corev1.EnvVarArray{
+								&corev1.EnvVarArgs{
+									Name:  pulumi.String("REDIS_ADDR"),
+									Value: pulumi.Sprintf("%s://%s:6379", scheme, redisEndpoint),
+								},
+								&corev1.EnvVarArgs{
+									Name:  pulumi.String("REDIS_EXPORTER_IS_CLUSTER"),
+									Value: pulumi.String("true"),
+								},
+							},
+							Resources: &corev1.ResourceRequirementsArgs{
+								Requests: pulumi.StringMap{
+									"memory": pulumi.String("64Mi"),
+									"cpu":    pulumi.String("50m"),
+								},
+								Limits: pulumi.StringMap{
+									"memory": pulumi.String("128Mi"),
+									"cpu":    pulumi.String("200m"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := corev1.NewService(ctx, "redis-exporter", &corev1.ServiceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("redis-exporter"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Spec: &corev1.ServiceSpecArgs{
+			Selector: labels,
+			Ports: corev1.ServicePortArray{
+				&corev1.ServicePortArgs{
+					Name:       pulumi.String("metrics"),
+					Port:       pulumi.Int(9121),
+					TargetPort: pulumi.Int(9121),
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisExporterResult{
+		ServiceName: pulumi.Sprintf("%s.%s.svc.cluster.local", service.Metadata.Name().Elem(), service.Metadata.Namespace().Elem()),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// ambientRegion is the region the default AWS provider would use: aws:region, then
+// AWS_REGION, then AWS_DEFAULT_REGION; empty when none is set
+func ambientRegion(ctx *pulumi.Context) string {
+	if region := config.New(ctx, "aws").Get("region"); region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// resolveRegion defaults region to the ambient one and rejects a region that
+// disagrees with it unless allowRegionMismatch is set, so resources and the dashboard
+// never silently point at different regions
+func (c *LabConfig) resolveRegion(ambient string) error {
+	if c.Region == "" {
+		if ambient == "" {
+			return fmt.Errorf("region: not set and no aws:region, AWS_REGION or AWS_DEFAULT_REGION to default to")
+		}
+		c.Region = ambient
+		return nil
+	}
+	if ambient != "" && ambient != c.Region && !c.AllowRegionMismatch {
+		return fmt.Errorf("region: %s disagrees with the ambient region %s; set allowRegionMismatch: true to deploy to %s anyway", c.Region, ambient, c.Region)
+	}
+	return nil
+}
+
+// runDefaultTags stamps the run ID on every resource an AWS provider creates
+func runDefaultTags(runId string) *aws.ProviderDefaultTagsArgs {
+	return &aws.ProviderDefaultTagsArgs{
+		Tags: pulumi.StringMap{
+			"RunId": pulumi.String(runId),
+		},
+	}
+}
+
+// NewAwsProvider creates the explicit AWS provider every lab resource and lookup
+// uses, pinned to cfg.Region and to the plugin version in cfg.ProviderVersion
+func NewAwsProvider(ctx *pulumi.Context, cfg *LabConfig) (*aws.Provider, error) {
+	var opts []pulumi.ResourceOption
+	if version := cfg.ProviderVersion["aws"]; version != "" {
+		opts = append(opts, pulumi.Version(version))
+	}
+	return aws.NewProvider(ctx, "redis-failover-lab-aws", &aws.ProviderArgs{
+		Region:      pulumi.String(cfg.Region),
+		DefaultTags: runDefaultTags(cfg.RunId),
+	}, opts...)
+}
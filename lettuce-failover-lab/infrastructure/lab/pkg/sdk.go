@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	cloudwatchsdk "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// sdkConfigs caches AWS SDK configurations for the run, keyed by region
+var (
+	sdkConfigsMu sync.Mutex
+	sdkConfigs   = map[string]awssdk.Config{}
+)
+
+// sdkConfig loads the AWS SDK configuration for region, for the reads pulumi-aws has
+// no data source for. Like NewAwsProvider it takes credentials from the default chain
+func sdkConfig(region string) (awssdk.Config, error) {
+	sdkConfigsMu.Lock()
+	defer sdkConfigsMu.Unlock()
+	if cached, ok := sdkConfigs[region]; ok {
+		return cached, nil
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return awssdk.Config{}, fmt.Errorf("loading AWS SDK configuration: %w", err)
+	}
+	sdkConfigs[region] = cfg
+	return cfg, nil
+}
+
+// lookupShardPrimaries returns the current primary of each shard (0001, 0002, ...) as
+// its node suffix (0001-002, ...). Cluster mode reports no node roles, so the primary
+// is the member whose IsMaster metric last read 1 within the past 10 minutes; shards
+// with no such member yet, e.g. right after creation, are left out
+func lookupShardPrimaries(region, replicationGroupId string, shardReplicas []int) (map[string]string, error) {
+	cfg, err := sdkConfig(region)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := nodeSuffixes(shardReplicas)
+	queries := make([]cloudwatchtypes.MetricDataQuery, 0, len(nodes))
+	for i, node := range nodes {
+		queries = append(queries, cloudwatchtypes.MetricDataQuery{
+			Id: awssdk.String(fmt.Sprintf("m%d", i)),
+			MetricStat: &cloudwatchtypes.MetricStat{
+				Metric: &cloudwatchtypes.Metric{
+					Namespace:  awssdk.String("AWS/ElastiCache"),
+					MetricName: awssdk.String("IsMaster"),
+					Dimensions: []cloudwatchtypes.Dimension{
+						{Name: awssdk.String("CacheClusterId"), Value: awssdk.String(replicationGroupId + "-" + node)},
+						{Name: awssdk.String("CacheNodeId"), Value: awssdk.String("0001")},
+					},
+				},
+				Period: awssdk.Int32(60),
+				Stat:   awssdk.String("Maximum"),
+			},
+		})
+	}
+
+	end := time.Now()
+	output, err := cloudwatchsdk.NewFromConfig(cfg).GetMetricData(context.Background(), &cloudwatchsdk.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         awssdk.Time(end.Add(-10 * time.Minute)),
+		EndTime:           awssdk.Time(end),
+		ScanBy:            cloudwatchtypes.ScanByTimestampDescending,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading IsMaster of %s: %w", replicationGroupId, err)
+	}
+
+	primaries := map[string]string{}
+	for _, result := range output.MetricDataResults {
+		var i int
+		if _, err := fmt.Sscanf(awssdk.ToString(result.Id), "m%d", &i); err != nil || i >= len(nodes) {
+			continue
+		}
+		if len(result.Values) > 0 && result.Values[0] == 1 {
+			node := nodes[i]
+			primaries[node[:4]] = node
+		}
+	}
+	return primaries, nil
+}
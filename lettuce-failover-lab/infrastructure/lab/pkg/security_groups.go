@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// securityGroupEntry describes one security group and what the lab attaches it to
+func securityGroupEntry(id pulumi.StringInput, source string, attachedTo []string) pulumi.Map {
+	return pulumi.Map{
+		"securityGroupId": id,
+		"source":          pulumi.String(source),
+		"attachedTo":      pulumi.ToStringArray(attachedTo),
+	}
+}
+
+// SecurityGroupMapping lists every security group in play and the resources it is
+// attached to, so reviewers can see what can talk to what. The network stack creates
+// no VPC endpoints or bastion, so none appear here
+func SecurityGroupMapping(cfg *LabConfig, eksResult *EKSResult) pulumi.MapArray {
+	var redisAttachments []string
+	for _, cluster := range cfg.Clusters {
+		redisAttachments = append(redisAttachments, fmt.Sprintf("elasticache replication group %s", clusterResourcePrefix(cluster.Key)))
+	}
+
+	// The network stack's EKS group allows Redis ingress but is only attached to the canary
+	eksAttachments := []string{}
+	if cfg.CreateCanary {
+		eksAttachments = append(eksAttachments, "synthetics canary redis-failover-lab")
+	}
+
+	mapping := pulumi.MapArray{
+		securityGroupEntry(eksResult.ClusterSecurityGroupId, "lab stack (pulumi-eks)", []string{"eks control plane redis-failover-lab-eks"}),
+		securityGroupEntry(eksResult.NodeSecurityGroupId, "lab stack (pulumi-eks)", []string{"eks worker nodes redis-failover-lab-eks"}),
+		securityGroupEntry(pulumi.String(cfg.EksSecurityGroupId), "network stack (eksSecurityGroupId)", eksAttachments),
+		securityGroupEntry(pulumi.String(cfg.RedisSecurityGroupId), "network stack (redisSecurityGroupId)", redisAttachments),
+	}
+	for _, id := range cfg.ExtraRedisSecurityGroupIds {
+		mapping = append(mapping, securityGroupEntry(pulumi.String(id), "config (extraRedisSecurityGroupIds)", redisAttachments))
+	}
+	return mapping
+}
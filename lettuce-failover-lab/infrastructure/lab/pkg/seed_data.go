@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"strconv"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	batchv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/batch/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// seedKeyPrefix namespaces the seeded keys away from the app's own keys
+const seedKeyPrefix = "seed:"
+
+// seedDataSource writes SEED_KEY_COUNT keys whose values derive only from their
+// index, and deletes seed keys left beyond that count by an earlier, larger run,
+// so every run starts from exactly the same dataset
+const seedDataSource = `import hashlib
+import os
+
+from redis.cluster import RedisCluster
+
+host, port = os.environ["REDIS_CLUSTER_ENDPOINT"].rsplit(":", 1)
+prefix = os.environ["SEED_KEY_PREFIX"]
+ssl = os.environ["REDIS_SSL_ENABLED"] == "true"
+count = int(os.environ["SEED_KEY_COUNT"])
+BATCH = 1000
+
+cluster = RedisCluster(host=host, port=int(port), ssl=ssl)
+
+stale = [
+    key for key in cluster.scan_iter(match=prefix + "*", count=BATCH)
+    if int(key.decode()[len(prefix):]) >= count
+]
+for start in range(0, len(stale), BATCH):
+    pipe = cluster.pipeline()
+    for key in stale[start:start + BATCH]:
+        pipe.delete(key)
+    pipe.execute()
+
+for start in range(0, count, BATCH):
+    pipe = cluster.pipeline()
+    for i in range(start, min(start + BATCH, count)):
+        pipe.set(prefix + str(i), hashlib.sha256(str(i).encode()).hexdigest())
+    pipe.execute()
+print("seeded %d keys, removed %d stale keys" % (count, len(stale)), flush=True)
+`
+
+type SeedDataResult struct {
+	JobName pulumi.StringOutput
+	// RedisEndpoint is the configuration endpoint, resolved once the Job completes,
+	// so workloads given it start on the seeded dataset
+	RedisEndpoint pulumi.StringOutput
+}
+
+// DeploySeedDataJob runs a Job writing keyCount deterministic keys (seed:<i>) to the
+// cluster. Pulumi waits for the Job to complete; a changed keyCount replaces the Job
+// and seeds again, as does pulumi up --replace on it before a test run
+func DeploySeedDataJob(ctx *pulumi.Context, provider *kubernetes.Provider, namespace *corev1.Namespace, redisEndpoint pulumi.StringOutput, tls bool, keyCount int) (*SeedDataResult, error) {
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name":    pulumi.String("seed-data"),
+		"app.kubernetes.io/part-of": pulumi.String("lettuce-redis-failover-lab"),
+	}
+
+	script, err := corev1.NewConfigMap(ctx, "seed-data", &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String("seed-data"),
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Data: pulumi.StringMap{
+			"seed.py": pulumi.String(seedDataSource),
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := batchv1.NewJob(ctx, "seed-data", &batchv1.JobArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Namespace: namespace.Metadata.Name(),
+			Labels:    labels,
+		},
+		Spec: &batchv1.JobSpecArgs{
+			BackoffLimit: pulumi.Int(2),
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: labels,
+				},
+				Spec: &corev1.PodSpecArgs{
+					RestartPolicy: pulumi.String("Never"),
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:  pulumi.String("seed-data"),
+							Image: pulumi.String("python:3.12-slim"),
+							Command: pulumi.StringArray{
+								pulumi.String("/bin/sh"),
+								pulumi.String("-c"),
+								pulumi.String("pip install --quiet redis==5.0.8 && exec python -u /seed/seed.py"),
+							},
+							Env: corev1.EnvVarArray{
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_CLUSTER_ENDPOINT"), Value: pulumi.Sprintf("%s:6379", redisEndpoint)},
+								&corev1.EnvVarArgs{Name: pulumi.String("REDIS_SSL_ENABLED"), Value: pulumi.String(strconv.FormatBool(tls))},
+								&corev1.EnvVarArgs{Name: pulumi.String("SEED_KEY_PREFIX"), Value: pulumi.String(seedKeyPrefix)},
+								&corev1.EnvVarArgs{Name: pulumi.String("SEED_KEY_COUNT"), Value: pulumi.String(strconv.Itoa(keyCount))},
+							},
+							VolumeMounts: corev1.VolumeMountArray{
+								&corev1.VolumeMountArgs{
+									Name:      pulumi.String("seed"),
+									MountPath: pulumi.String("/seed"),
+								},
+							},
+							Resources: &corev1.ResourceRequirementsArgs{
+								Requests: pulumi.StringMap{
+									"memory": pulumi.String("128Mi"),
+									"cpu":    pulumi.String("100m"),
+								},
+								Limits: pulumi.StringMap{
+									"memory": pulumi.String("512Mi"),
+									"cpu":    pulumi.String("500m"),
+								},
+							},
+						},
+					},
+					Volumes: corev1.VolumeArray{
+						&corev1.VolumeArgs{
+							Name: pulumi.String("seed"),
+							ConfigMap: &corev1.ConfigMapVolumeSourceArgs{
+								Name: script.Metadata.Name(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	jobName := job.Metadata.Name().Elem()
+	return &SeedDataResult{
+		JobName: jobName,
+		RedisEndpoint: pulumi.All(redisEndpoint, jobName).ApplyT(func(args []interface{}) string {
+			return args[0].(string)
+		}).(pulumi.StringOutput),
+	}, nil
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// shardReplicasSource brings each node group to its requested replica count. The
+// provider only sets one count for every node group, so uneven shards are reached
+// with IncreaseReplicaCount and DecreaseReplicaCount, which take a count per node
+// group. Adding replicas can outlast the invocation; the change then carries on in
+// ElastiCache and any decreases still to make are returned as pending
+const shardReplicasSource = `import time
+
+import boto3
+
+elasticache = boto3.client("elasticache")
+
+# Stop waiting for the replication group when less than this is left of the invocation
+WAIT_BUDGET_MS = 30000
+
+
+def describe(group_id):
+    return elasticache.describe_replication_groups(ReplicationGroupId=group_id)["ReplicationGroups"][0]
+
+
+def wait_available(group_id, context):
+    while describe(group_id)["Status"] != "available":
+        if context.get_remaining_time_in_millis() < WAIT_BUDGET_MS:
+            return False
+        time.sleep(15)
+    return True
+
+
+def handler(event, context):
+    group_id = event["replicationGroupId"]
+    if not wait_available(group_id, context):
+        return {"status": "modifying", "pending": event["replicaConfiguration"]}
+    current = {
+        group["NodeGroupId"]: len(group["NodeGroupMembers"]) - 1
+        for group in describe(group_id)["NodeGroups"]
+    }
+    increase = [c for c in event["replicaConfiguration"] if c["NewReplicaCount"] > current[c["NodeGroupId"]]]
+    decrease = [
+        {"NodeGroupId": c["NodeGroupId"], "NewReplicaCount": c["NewReplicaCount"]}
+        for c in event["replicaConfiguration"]
+        if c["NewReplicaCount"] < current[c["NodeGroupId"]]
+    ]
+
+    if increase:
+        elasticache.increase_replica_count(
+            ReplicationGroupId=group_id, ReplicaConfiguration=increase, ApplyImmediately=True)
+        # The change takes a moment to show in the group status
+        time.sleep(30)
+        if not wait_available(group_id, context):
+            return {"status": "modifying", "pending": decrease}
+    if decrease:
+        elasticache.decrease_replica_count(
+            ReplicationGroupId=group_id, ReplicaConfiguration=decrease, ApplyImmediately=True)
+        time.sleep(30)
+        if not wait_available(group_id, context):
+            return {"status": "modifying", "pending": []}
+    return {"status": "available", "pending": []}
+`
+
+// applyShardReplicas sets the replicas of each shard of the replication group to
+// shardReplicas through a Lambda invoked whenever the counts change; ElastiCache
+// places the added replicas
+func applyShardReplicas(ctx *pulumi.Context, awsProvider *aws.Provider, prefix string, replicationGroupId pulumi.StringOutput, shardReplicas []int) (*lambda.Invocation, error) {
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-shard-replicas-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-shard-replicas-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-shard-replicas-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	replicasPolicy, err := iam.NewRolePolicy(ctx, prefix+"-shard-replicas-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": [
+						"elasticache:DescribeReplicationGroups",
+						"elasticache:IncreaseReplicaCount",
+						"elasticache:DecreaseReplicaCount"
+					],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-shard-replicas", &lambda.FunctionArgs{
+		Description: pulumi.String("Sets the replica count of each Failover Lab shard"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(900),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(shardReplicasSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-shard-replicas"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, replicasPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	var replicaConfiguration []map[string]interface{}
+	for shard, replicas := range shardReplicas {
+		replicaConfiguration = append(replicaConfiguration, map[string]interface{}{
+			"NodeGroupId":     fmt.Sprintf("%04d", shard+1),
+			"NewReplicaCount": replicas,
+		})
+	}
+	input := replicationGroupId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]interface{}{
+			"replicationGroupId":   id,
+			"replicaConfiguration": replicaConfiguration,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	return lambda.NewInvocation(ctx, prefix+"-shard-replicas", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.Provider(awsProvider))
+}
@@ -0,0 +1,254 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// initialSnapshotSource starts a manual snapshot of the replication group
+// An existing snapshot of the same name is kept, so re-invocations are harmless
+const initialSnapshotSource = `import boto3
+
+elasticache = boto3.client("elasticache")
+
+
+def handler(event, context):
+    try:
+        snapshot = elasticache.create_snapshot(
+            ReplicationGroupId=event["replicationGroupId"],
+            SnapshotName=event["snapshotName"],
+        )["Snapshot"]
+        status = snapshot["SnapshotStatus"]
+    except elasticache.exceptions.SnapshotAlreadyExistsFault:
+        status = "exists"
+    return {"snapshotName": event["snapshotName"], "status": status}
+`
+
+type InitialSnapshotResult struct {
+	SnapshotName pulumi.StringOutput
+}
+
+// CreateInitialSnapshot takes a manual snapshot of the replication group once it is
+// created, as a baseline to restore between experiments. The Terraform-based AWS
+// provider has no ElastiCache snapshot resource, so a Lambda invoked on create calls
+// CreateSnapshot; the snapshot outlives the stack and must be deleted manually
+// Like the final snapshot, non-default clusters append their key to snapshotName
+func CreateInitialSnapshot(ctx *pulumi.Context, awsProvider *aws.Provider, clusterKey string, rgId pulumi.StringOutput, snapshotName string) (*InitialSnapshotResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+	if clusterKey != defaultClusterKey {
+		snapshotName += "-" + clusterKey
+	}
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-initial-snapshot-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-initial-snapshot-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-initial-snapshot-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	snapshotPolicy, err := iam.NewRolePolicy(ctx, prefix+"-initial-snapshot-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": ["elasticache:CreateSnapshot", "elasticache:AddTagsToResource"],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-initial-snapshot", &lambda.FunctionArgs{
+		Description: pulumi.String("Takes the Failover Lab baseline snapshot after the cluster is created"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(30),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(initialSnapshotSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-initial-snapshot"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, snapshotPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := rgId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]string{
+			"replicationGroupId": id,
+			"snapshotName":       snapshotName,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	// Invoked once on create, and again only if the group or name changes
+	invocation, err := lambda.NewInvocation(ctx, prefix+"-initial-snapshot", &lambda.InvocationArgs{
+		FunctionName: function.Name,
+		Input:        input,
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &InitialSnapshotResult{
+		SnapshotName: invocation.Result.ApplyT(func(result string) (string, error) {
+			var response struct {
+				SnapshotName string `json:"snapshotName"`
+			}
+			err := json.Unmarshal([]byte(result), &response)
+			return response.SnapshotName, err
+		}).(pulumi.StringOutput),
+	}, nil
+}
+
+// preDestroySnapshotSource snapshots the replication group when the invocation is
+// deleted and waits for the snapshot to become available, so the group is only
+// deleted once its data is safe. The snapshot name is the prefix plus the UTC time,
+// so every destroy, including a rerun after a timeout, takes a fresh snapshot
+const preDestroySnapshotSource = `import time
+from datetime import datetime, timezone
+
+import boto3
+
+elasticache = boto3.client("elasticache")
+
+
+def handler(event, context):
+    if event.get("tf", {}).get("action") != "delete":
+        return {"snapshotNamePrefix": event["snapshotNamePrefix"], "status": "pending"}
+
+    snapshot_name = "%s-%s" % (event["snapshotNamePrefix"], datetime.now(timezone.utc).strftime("%Y%m%d-%H%M%S"))
+    elasticache.create_snapshot(
+        ReplicationGroupId=event["replicationGroupId"],
+        SnapshotName=snapshot_name,
+    )
+    while True:
+        status = elasticache.describe_snapshots(
+            SnapshotName=snapshot_name,
+        )["Snapshots"][0]["SnapshotStatus"]
+        if status == "available":
+            return {"snapshotName": snapshot_name, "status": status}
+        if status != "creating":
+            raise RuntimeError("snapshot %s is %s" % (snapshot_name, status))
+        time.sleep(15)
+`
+
+type PreDestroySnapshotResult struct {
+	// SnapshotNamePrefix is followed by -<UTC time of the destroy>, e.g. -20250115-103000
+	SnapshotNamePrefix string
+}
+
+// CreatePreDestroySnapshot takes a manual snapshot of the replication group when it is
+// about to be destroyed. The lambda.Invocation depends on the group, so on destroy it
+// is deleted, invoking the Lambda, before the group; a failed or timed-out snapshot
+// fails the destroy instead of losing data. The snapshot is
+// redis-failover-lab-pre-destroy-<time> (with the key for non-default clusters) and
+// outlives the stack; each destroy adds one, so old ones must be deleted manually
+func CreatePreDestroySnapshot(ctx *pulumi.Context, awsProvider *aws.Provider, clusterKey string, rgId pulumi.StringOutput) (*PreDestroySnapshotResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+	snapshotNamePrefix := prefix + "-pre-destroy"
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, prefix+"-pre-destroy-snapshot-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(prefix + "-pre-destroy-snapshot-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, prefix+"-pre-destroy-snapshot-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+	snapshotPolicy, err := iam.NewRolePolicy(ctx, prefix+"-pre-destroy-snapshot-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Effect": "Allow",
+					"Action": ["elasticache:CreateSnapshot", "elasticache:DescribeSnapshots", "elasticache:AddTagsToResource"],
+					"Resource": "*"
+				}
+			]
+		}`),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, prefix+"-pre-destroy-snapshot", &lambda.FunctionArgs{
+		Description: pulumi.String("Snapshots the Failover Lab cluster before it is destroyed"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(900),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(preDestroySnapshotSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-pre-destroy-snapshot"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy, snapshotPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	input := rgId.ApplyT(func(id string) (string, error) {
+		bytes, err := json.Marshal(map[string]string{
+			"replicationGroupId": id,
+			"snapshotNamePrefix": snapshotNamePrefix,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	// Invoked on create (no-op) and again on delete, when the snapshot is taken
+	_, err = lambda.NewInvocation(ctx, prefix+"-pre-destroy-snapshot", &lambda.InvocationArgs{
+		FunctionName:   function.Name,
+		Input:          input,
+		LifecycleScope: pulumi.String("CRUD"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreDestroySnapshotResult{
+		SnapshotNamePrefix: snapshotNamePrefix,
+	}, nil
+}
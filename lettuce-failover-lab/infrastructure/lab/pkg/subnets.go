@@ -0,0 +1,383 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ValidateSubnetsInVpc checks that every subnet ID belongs to the given VPC
+// key is the config key the subnets came from, used in error messages
+func ValidateSubnetsInVpc(ctx *pulumi.Context, awsProvider *aws.Provider, vpcId string, key string, subnetIds []string) error {
+	vpcSubnets, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
+		Filters: []ec2.GetSubnetsFilter{
+			{
+				Name:   "vpc-id",
+				Values: []string{vpcId},
+			},
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(vpcSubnets.Ids))
+	for _, id := range vpcSubnets.Ids {
+		known[id] = true
+	}
+	for _, id := range subnetIds {
+		if !known[id] {
+			return fmt.Errorf("%s: subnet %s is not in VPC %s", key, id, vpcId)
+		}
+	}
+	return nil
+}
+
+// lookedUpSubnets caches subnet lookups for the run; the same subnets are otherwise
+// described again for every cluster and every placement check
+var (
+	lookedUpSubnetsMu sync.Mutex
+	lookedUpSubnets   = map[string]*ec2.LookupSubnetResult{}
+)
+
+// lookupSubnets describes the subnets concurrently, reusing cached results, and
+// returns them keyed by subnet ID
+func lookupSubnets(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string) (map[string]*ec2.LookupSubnetResult, error) {
+	subnets := make(map[string]*ec2.LookupSubnetResult, len(subnetIds))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	for _, id := range subnetIds {
+		lookedUpSubnetsMu.Lock()
+		cached, ok := lookedUpSubnets[id]
+		lookedUpSubnetsMu.Unlock()
+		if ok {
+			subnets[id] = cached
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			subnet, err := ec2.LookupSubnet(ctx, &ec2.LookupSubnetArgs{
+				Id: pulumi.StringRef(id),
+			}, pulumi.Provider(awsProvider))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			subnets[id] = subnet
+			lookedUpSubnetsMu.Lock()
+			lookedUpSubnets[id] = subnet
+			lookedUpSubnetsMu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return subnets, nil
+}
+
+// subnetAzs looks up the availability zone of each subnet, keyed by subnet ID
+func subnetAzs(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string) (map[string]string, error) {
+	subnets, err := lookupSubnets(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return nil, err
+	}
+	azs := make(map[string]string, len(subnets))
+	for id, subnet := range subnets {
+		azs[id] = subnet.AvailabilityZone
+	}
+	return azs, nil
+}
+
+// selectSubnetsByAz returns the first azCount subnets that are each in a distinct AZ,
+// preserving the order of subnetIds. azCount of 0 returns subnetIds unchanged
+func selectSubnetsByAz(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string, azCount int) ([]string, error) {
+	if azCount == 0 {
+		return subnetIds, nil
+	}
+	if azCount < 0 {
+		return nil, fmt.Errorf("eksAzCount must be positive, got %d", azCount)
+	}
+
+	azs, err := subnetAzs(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var selected []string
+	for _, id := range subnetIds {
+		az := azs[id]
+		if seen[az] {
+			continue
+		}
+		seen[az] = true
+		if len(selected) < azCount {
+			selected = append(selected, id)
+		}
+	}
+	if azCount > len(seen) {
+		return nil, fmt.Errorf("eksAzCount is %d but the provided subnets only span %d distinct AZs", azCount, len(seen))
+	}
+	return selected, nil
+}
+
+// selectSubnetsInAzs returns the subnets whose AZ is in azs, preserving the order of
+// subnetIds. Every AZ must have a subnet and at least 2 AZs must remain for multi-AZ.
+// Empty azs returns subnetIds unchanged
+func selectSubnetsInAzs(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string, azs []string) ([]string, error) {
+	if len(azs) == 0 {
+		return subnetIds, nil
+	}
+	if len(azs) < 2 {
+		return nil, fmt.Errorf("elasticacheAzs must list at least 2 AZs for multi-AZ, got %d", len(azs))
+	}
+
+	subnetAz, err := subnetAzs(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(azs))
+	for _, az := range azs {
+		wanted[az] = true
+	}
+	covered := map[string]bool{}
+	var selected []string
+	for _, id := range subnetIds {
+		az := subnetAz[id]
+		if wanted[az] {
+			selected = append(selected, id)
+			covered[az] = true
+		}
+	}
+	for _, az := range azs {
+		if !covered[az] {
+			return nil, fmt.Errorf("elasticacheAzs: no ElastiCache subnet in AZ %s", az)
+		}
+	}
+	return selected, nil
+}
+
+// validateSubnetsMultiAz checks the subnets span at least 2 AZs, as multi-AZ
+// replication groups require
+func validateSubnetsMultiAz(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string) error {
+	azs, err := subnetAzs(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return err
+	}
+	distinct := map[string]bool{}
+	for _, az := range azs {
+		distinct[az] = true
+	}
+	if len(distinct) < 2 {
+		return fmt.Errorf("subnets span %d AZ, multi-AZ needs at least 2", len(distinct))
+	}
+	return nil
+}
+
+// validateSubnetsNetworkType checks every subnet can host ElastiCache nodes of networkType:
+// ipv6 needs IPv6-only subnets and dual_stack needs an IPv6 CIDR alongside IPv4
+func validateSubnetsNetworkType(ctx *pulumi.Context, awsProvider *aws.Provider, subnetIds []string, networkType string) error {
+	if networkType == "ipv4" {
+		return nil
+	}
+	subnets, err := lookupSubnets(ctx, awsProvider, subnetIds)
+	if err != nil {
+		return err
+	}
+	for _, id := range subnetIds {
+		subnet := subnets[id]
+		switch {
+		case networkType == "ipv6" && !subnet.Ipv6Native:
+			return fmt.Errorf("networkType ipv6: subnet %s is not IPv6-only", id)
+		case networkType == "dual_stack" && (subnet.Ipv6CidrBlock == "" || subnet.Ipv6Native):
+			return fmt.Errorf("networkType dual_stack: subnet %s has no IPv6 CIDR alongside IPv4", id)
+		}
+	}
+	return nil
+}
+
+// ElasticacheSubnetsResult holds the dedicated ElastiCache subnets
+type ElasticacheSubnetsResult struct {
+	SubnetIds pulumi.StringArray
+}
+
+// CreateElasticacheSubnets creates one private subnet per elasticacheSubnetCidrs entry,
+// spreading them across elasticacheAzs (default: the AZs of privateSubnetIds), and
+// associates each with the route table of the first private subnet
+func CreateElasticacheSubnets(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig) (*ElasticacheSubnetsResult, error) {
+	if err := validateSubnetCidrsInVpc(ctx, awsProvider, cfg.VpcId, cfg.ElasticacheSubnetCidrs); err != nil {
+		return nil, err
+	}
+
+	azs := cfg.ElasticacheAzs
+	if len(azs) == 0 {
+		privateAzs, err := subnetAzs(ctx, awsProvider, cfg.PrivateSubnetIds)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, id := range cfg.PrivateSubnetIds {
+			if az := privateAzs[id]; !seen[az] {
+				seen[az] = true
+				azs = append(azs, az)
+			}
+		}
+	}
+	if len(azs) < 2 {
+		return nil, fmt.Errorf("elasticacheSubnetCidrs: privateSubnetIds span %d AZ; set elasticacheAzs to at least 2 AZs for multi-AZ", len(azs))
+	}
+
+	routeTableId, err := privateRouteTableId(ctx, awsProvider, cfg.VpcId, cfg.PrivateSubnetIds[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ElasticacheSubnetsResult{}
+	for i, cidr := range cfg.ElasticacheSubnetCidrs {
+		name := elasticacheSubnetName(i)
+		az := azs[i%len(azs)]
+		subnet, err := ec2.NewSubnet(ctx, name, &ec2.SubnetArgs{
+			VpcId:            pulumi.String(cfg.VpcId),
+			CidrBlock:        pulumi.String(cidr),
+			AvailabilityZone: pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"Name":        pulumi.String(name),
+				"Environment": pulumi.String("testing"),
+			},
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		_, err = ec2.NewRouteTableAssociation(ctx, name, &ec2.RouteTableAssociationArgs{
+			SubnetId:     subnet.ID(),
+			RouteTableId: pulumi.String(routeTableId),
+		}, pulumi.Provider(awsProvider))
+		if err != nil {
+			return nil, err
+		}
+		result.SubnetIds = append(result.SubnetIds, subnet.ID())
+	}
+	return result, nil
+}
+
+// elasticacheSubnetName is the resource and Name tag of the i-th dedicated ElastiCache subnet
+func elasticacheSubnetName(i int) string {
+	return fmt.Sprintf("redis-failover-lab-elasticache-subnet-%d", i)
+}
+
+// validateSubnetCidrsInVpc checks each CIDR lies within a VPC CIDR block and does not
+// overlap any existing subnet of the VPC. Subnets a previous up created for the same
+// entry (same Name tag and exact CIDR) are the lab's own and are not counted
+func validateSubnetCidrsInVpc(ctx *pulumi.Context, awsProvider *aws.Provider, vpcId string, cidrs []string) error {
+	vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
+		Id: pulumi.StringRef(vpcId),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	vpcCidrs := []string{vpc.CidrBlock}
+	for _, association := range vpc.CidrBlockAssociations {
+		vpcCidrs = append(vpcCidrs, association.CidrBlock)
+	}
+
+	vpcSubnets, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
+		Filters: []ec2.GetSubnetsFilter{
+			{
+				Name:   "vpc-id",
+				Values: []string{vpcId},
+			},
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	subnets, err := lookupSubnets(ctx, awsProvider, vpcSubnets.Ids)
+	if err != nil {
+		return err
+	}
+	type ownedSubnet struct{ name, cidr string }
+	owned := make(map[ownedSubnet]bool, len(cidrs))
+	for i, cidr := range cidrs {
+		owned[ownedSubnet{elasticacheSubnetName(i), cidr}] = true
+	}
+	existing := map[string]string{}
+	for id, subnet := range subnets {
+		if owned[ownedSubnet{subnet.Tags["Name"], subnet.CidrBlock}] {
+			continue
+		}
+		existing[id] = subnet.CidrBlock
+	}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("elasticacheSubnetCidrs: %q is not a valid CIDR", cidr)
+		}
+		inside := false
+		for _, vpcCidr := range vpcCidrs {
+			if _, vpcNetwork, err := net.ParseCIDR(vpcCidr); err == nil && cidrContains(vpcNetwork, network) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return fmt.Errorf("elasticacheSubnetCidrs: %s is outside the CIDR blocks of VPC %s (%s)", cidr, vpcId, strings.Join(vpcCidrs, ", "))
+		}
+		for id, subnetCidr := range existing {
+			if _, subnetNetwork, err := net.ParseCIDR(subnetCidr); err == nil && cidrsOverlap(network, subnetNetwork) {
+				return fmt.Errorf("elasticacheSubnetCidrs: %s overlaps subnet %s (%s)", cidr, id, subnetCidr)
+			}
+		}
+	}
+	return nil
+}
+
+// privateRouteTableId returns the route table explicitly associated with subnetId,
+// falling back to the VPC main route table the subnet implicitly uses
+func privateRouteTableId(ctx *pulumi.Context, awsProvider *aws.Provider, vpcId string, subnetId string) (string, error) {
+	routeTable, err := ec2.LookupRouteTable(ctx, &ec2.LookupRouteTableArgs{
+		SubnetId: pulumi.StringRef(subnetId),
+	}, pulumi.Provider(awsProvider))
+	if err == nil {
+		return routeTable.RouteTableId, nil
+	}
+	mainRouteTable, err := ec2.LookupRouteTable(ctx, &ec2.LookupRouteTableArgs{
+		VpcId: pulumi.StringRef(vpcId),
+		Filters: []ec2.GetRouteTableFilter{
+			{
+				Name:   "association.main",
+				Values: []string{"true"},
+			},
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return "", fmt.Errorf("no route table found for subnet %s: %w", subnetId, err)
+	}
+	return mainRouteTable.RouteTableId, nil
+}
+
+// cidrContains reports whether inner lies entirely within outer
+func cidrContains(outer, inner *net.IPNet) bool {
+	outerOnes, _ := outer.Mask.Size()
+	innerOnes, _ := inner.Mask.Size()
+	return outer.Contains(inner.IP) && innerOnes >= outerOnes
+}
+
+// cidrsOverlap reports whether two networks share any address
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// teardownNotifierSource posts to the webhook when the invocation resource is deleted
+// lambda.Invocation with CRUD lifecycle passes the action under the "tf" key. The
+// webhook URL carries its token, so it is read from a SecureString parameter
+// rather than the invocation input
+const teardownNotifierSource = `import json
+import urllib.request
+from datetime import datetime, timezone
+
+import boto3
+
+ssm = boto3.client("ssm")
+
+
+def handler(event, context):
+    if event.get("tf", {}).get("action") != "delete":
+        return {"notified": False}
+
+    body = json.dumps({
+        "text": "Lettuce Failover Lab stack %s/%s was destroyed" % (event["project"], event["stack"]),
+        "project": event["project"],
+        "stack": event["stack"],
+        "destroyedAt": datetime.now(timezone.utc).isoformat(),
+    }).encode()
+    webhook_url = ssm.get_parameter(
+        Name=event["webhookUrlParameter"], WithDecryption=True)["Parameter"]["Value"]
+    request = urllib.request.Request(
+        webhook_url, data=body, headers={"Content-Type": "application/json"}, method="POST")
+    with urllib.request.urlopen(request, timeout=10) as response:
+        return {"notified": True, "status": response.status}
+`
+
+// CreateTeardownNotifier posts the stack name and a timestamp to webhookUrl when the
+// stack is destroyed, via a Lambda invoked on delete of a lambda.Invocation resource
+// webhookUrl is kept as a secret and in a SecureString parameter the Lambda reads
+func CreateTeardownNotifier(ctx *pulumi.Context, awsProvider *aws.Provider, webhookUrl string) error {
+	parameter, err := ssm.NewParameter(ctx, "redis-failover-lab-teardown-webhook-url", &ssm.ParameterArgs{
+		Name:        pulumi.String("/redis-failover-lab/teardown-webhook-url"),
+		Description: pulumi.String("Webhook the Failover Lab teardown notifier posts to"),
+		Type:        pulumi.String("SecureString"),
+		Value:       pulumi.ToSecret(pulumi.String(webhookUrl)).(pulumi.StringOutput),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-teardown-webhook-url"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	assumeRolePolicy, err := createAssumeRolePolicy("lambda.amazonaws.com")
+	if err != nil {
+		return err
+	}
+	role, err := iam.NewRole(ctx, "redis-failover-lab-teardown-notifier-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(assumeRolePolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("redis-failover-lab-teardown-notifier-role"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	logsPolicy, err := iam.NewRolePolicyAttachment(ctx, "teardown-notifier-logs-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	// The invocation depends on the policy and parameter, so both outlive it on destroy
+	parameterPolicy, err := iam.NewRolePolicy(ctx, "teardown-notifier-parameter-policy", &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: parameter.Arn.ApplyT(func(arn string) (string, error) {
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect":   "Allow",
+						"Action":   "ssm:GetParameter",
+						"Resource": arn,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	function, err := lambda.NewFunction(ctx, "redis-failover-lab-teardown-notifier", &lambda.FunctionArgs{
+		Description: pulumi.String("Notifies a webhook when the Failover Lab stack is destroyed"),
+		Runtime:     pulumi.String("python3.12"),
+		Handler:     pulumi.String("index.handler"),
+		Role:        role.Arn,
+		Timeout:     pulumi.Int(15),
+		Code: pulumi.NewAssetArchive(map[string]interface{}{
+			"index.py": pulumi.NewStringAsset(teardownNotifierSource),
+		}),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-teardown-notifier"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.DependsOn([]pulumi.Resource{logsPolicy}), pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+
+	input := parameter.Name.ApplyT(func(name string) (string, error) {
+		bytes, err := json.Marshal(map[string]string{
+			"project":             ctx.Project(),
+			"stack":               ctx.Stack(),
+			"webhookUrlParameter": name,
+		})
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	// Invoked on create (no-op) and again on delete, when the webhook is posted
+	_, err = lambda.NewInvocation(ctx, "redis-failover-lab-teardown-notification", &lambda.InvocationArgs{
+		FunctionName:   function.Name,
+		Input:          input,
+		LifecycleScope: pulumi.String("CRUD"),
+	}, pulumi.DependsOn([]pulumi.Resource{parameterPolicy}), pulumi.Provider(awsProvider))
+	return err
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+type TlsPolicyResult struct {
+	ParameterName pulumi.StringOutput
+	Policy        string
+}
+
+type TlsEndpointResult struct {
+	ParameterName pulumi.StringOutput
+	// Endpoint is the tlsEndpoint record written to the parameter
+	Endpoint pulumi.MapOutput
+}
+
+// tlsPolicy describes the TLS the cluster endpoints negotiate with in-transit encryption
+type tlsPolicy struct {
+	EngineVersion     string   `json:"engineVersion"`
+	InTransitTls      bool     `json:"inTransitEncryption"`
+	MinimumTlsVersion string   `json:"minimumTlsVersion"`
+	TlsVersions       []string `json:"tlsVersions"`
+	Configurable      bool     `json:"configurable"`
+	Note              string   `json:"note"`
+}
+
+// tlsPolicyForEngine derives the endpoint TLS policy from the engine version
+// ElastiCache exposes no minimum-TLS or cipher-suite setting on replication groups:
+// encrypted endpoints always require TLS 1.2 or later with AWS-managed ciphers, and
+// 7.x engines additionally negotiate TLS 1.3. The policy is recorded, not enforced
+// Without in-transit encryption the endpoints negotiate no TLS at all
+func tlsPolicyForEngine(engineVersion, note string, inTransitTls bool) tlsPolicy {
+	if !inTransitTls {
+		return tlsPolicy{
+			EngineVersion: engineVersion,
+			TlsVersions:   []string{},
+			Note:          note,
+		}
+	}
+	versions := []string{"1.2"}
+	if strings.HasPrefix(engineVersion, "7.") {
+		versions = append(versions, "1.3")
+	}
+	return tlsPolicy{
+		EngineVersion:     engineVersion,
+		InTransitTls:      true,
+		MinimumTlsVersion: "1.2",
+		TlsVersions:       versions,
+		Configurable:      false,
+		Note:              note,
+	}
+}
+
+// CreateTlsPolicyRecord writes the endpoints' TLS policy to an informational SSM
+// parameter, giving security attestations a code-managed artifact
+func CreateTlsPolicyRecord(ctx *pulumi.Context, awsProvider *aws.Provider, cfg *LabConfig) (*TlsPolicyResult, error) {
+	engine, err := resolveEngineVersion(cfg.Region, cfg.EngineVersion)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := json.Marshal(tlsPolicyForEngine(engine.Version, cfg.TlsPolicyNote, *cfg.Encryption))
+	if err != nil {
+		return nil, err
+	}
+
+	parameter, err := ssm.NewParameter(ctx, "redis-failover-lab-tls-policy", &ssm.ParameterArgs{
+		Name:        pulumi.String("/redis-failover-lab/tls-policy"),
+		Description: pulumi.String("Informational: TLS versions the Failover Lab Redis endpoints negotiate"),
+		Type:        pulumi.String("String"),
+		Value:       pulumi.String(string(policy)),
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String("redis-failover-lab-tls-policy"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TlsPolicyResult{
+		ParameterName: parameter.Name,
+		Policy:        string(policy),
+	}, nil
+}
+
+// tlsEndpoint tells TLS clients which name to verify the server certificate against
+// ElastiCache has no mutual TLS: clients present no certificate, so there is no
+// client material to provision and only server verification is configurable
+type tlsEndpoint struct {
+	SniHostname     string `json:"sniHostname"`
+	CertificateName string `json:"certificateName"`
+	Port            int    `json:"port"`
+	MutualTls       bool   `json:"mutualTls"`
+	Note            string `json:"note"`
+}
+
+// tlsEndpointFor derives the SNI hostname and certificate name of a configuration
+// endpoint. Node endpoints share the configuration endpoint's parent domain, so a
+// wildcard on it matches every name the cluster topology returns
+func tlsEndpointFor(configurationEndpoint string, port int) tlsEndpoint {
+	parent := configurationEndpoint[strings.Index(configurationEndpoint, ".")+1:]
+	return tlsEndpoint{
+		SniHostname:     configurationEndpoint,
+		CertificateName: "*." + parent,
+		Port:            port,
+		MutualTls:       false,
+		Note:            "Connect to sniHostname, not an IP or a CNAME, so SNI and hostname verification match certificateName",
+	}
+}
+
+// CreateTlsEndpointRecord writes the cluster's SNI hostname and expected certificate
+// name to SSM, /redis-failover-lab[/<clusterKey>]/tls-endpoint, for clients to set
+// up hostname verification instead of disabling it on a name mismatch
+func CreateTlsEndpointRecord(ctx *pulumi.Context, awsProvider *aws.Provider, clusterKey string, redis *ElastiCacheResult) (*TlsEndpointResult, error) {
+	prefix := clusterResourcePrefix(clusterKey)
+	name := "/redis-failover-lab/tls-endpoint"
+	if clusterKey != defaultClusterKey {
+		name = "/redis-failover-lab/" + clusterKey + "/tls-endpoint"
+	}
+
+	endpoint := pulumi.All(redis.ConfigurationEndpoint, redis.Port).ApplyT(func(args []interface{}) (string, error) {
+		bytes, err := json.Marshal(tlsEndpointFor(args[0].(string), args[1].(int)))
+		return string(bytes), err
+	}).(pulumi.StringOutput)
+
+	parameter, err := ssm.NewParameter(ctx, prefix+"-tls-endpoint", &ssm.ParameterArgs{
+		Name:        pulumi.String(name),
+		Description: pulumi.String("SNI hostname and certificate name Failover Lab TLS clients verify"),
+		Type:        pulumi.String("String"),
+		Value:       endpoint,
+		Tags: pulumi.StringMap{
+			"Name":        pulumi.String(prefix + "-tls-endpoint"),
+			"Environment": pulumi.String("testing"),
+		},
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TlsEndpointResult{
+		ParameterName: parameter.Name,
+		Endpoint: endpoint.ApplyT(func(value string) (map[string]interface{}, error) {
+			var record map[string]interface{}
+			err := json.Unmarshal([]byte(value), &record)
+			return record, err
+		}).(pulumi.MapOutput),
+	}, nil
+}
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
@@ -13,14 +18,45 @@ func main() {
 		// Get configuration values
 		vpcId := cfg.Require("vpcId")
 
+		// Every resource and lookup goes through an explicit provider pinned to region
+		region, err := resolveRegion(cfg.Get("region"), ambientRegion(ctx), cfg.GetBool("allowRegionMismatch"))
+		if err != nil {
+			return err
+		}
+		awsProvider, err := aws.NewProvider(ctx, "failover-lab-network-aws", &aws.ProviderArgs{
+			Region: pulumi.String(region),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Optional security group descriptions and common tags
+		eksSgDescription := cfg.Get("eksSecurityGroupDescription")
+		if eksSgDescription == "" {
+			eksSgDescription = "Security group for Failover Lab EKS nodes"
+		}
+		redisSgDescription := cfg.Get("redisSecurityGroupDescription")
+		if redisSgDescription == "" {
+			redisSgDescription = "Security group for Failover Lab ElastiCache Redis"
+		}
+		if err := validateDescription("eksSecurityGroupDescription", eksSgDescription); err != nil {
+			return err
+		}
+		if err := validateDescription("redisSecurityGroupDescription", redisSgDescription); err != nil {
+			return err
+		}
+
+		var commonTags map[string]string
+		if err := cfg.GetObject("tags", &commonTags); err != nil {
+			return fmt.Errorf("invalid tags config: %w", err)
+		}
+
 		// Security group for EKS nodes
 		eksSecurityGroup, err := ec2.NewSecurityGroup(ctx, "redis-failover-lab-eks-sg", &ec2.SecurityGroupArgs{
 			VpcId:       pulumi.String(vpcId),
-			Description: pulumi.String("Security group for Failover Lab EKS nodes"),
-			Tags: pulumi.StringMap{
-				"Name": pulumi.String("redis-failover-lab-eks-sg"),
-			},
-		})
+			Description: pulumi.String(eksSgDescription),
+			Tags:        networkTags(commonTags, "redis-failover-lab-eks-sg"),
+		}, pulumi.Provider(awsProvider))
 		if err != nil {
 			return err
 		}
@@ -28,11 +64,9 @@ func main() {
 		// Security group for ElastiCache Redis
 		redisSecurityGroup, err := ec2.NewSecurityGroup(ctx, "redis-failover-lab-redis-sg", &ec2.SecurityGroupArgs{
 			VpcId:       pulumi.String(vpcId),
-			Description: pulumi.String("Security group for Failover Lab ElastiCache Redis"),
-			Tags: pulumi.StringMap{
-				"Name": pulumi.String("redis-failover-lab-redis-sg"),
-			},
-		})
+			Description: pulumi.String(redisSgDescription),
+			Tags:        networkTags(commonTags, "redis-failover-lab-redis-sg"),
+		}, pulumi.Provider(awsProvider))
 		if err != nil {
 			return err
 		}
@@ -46,37 +80,76 @@ func main() {
 			SecurityGroupId:       redisSecurityGroup.ID(),
 			SourceSecurityGroupId: eksSecurityGroup.ID(),
 			Description:           pulumi.String("Allow EKS nodes to connect to Redis"),
-		})
+		}, pulumi.Provider(awsProvider))
 		if err != nil {
 			return err
 		}
 
-		// Allow all outbound from Redis security group
-		_, err = ec2.NewSecurityGroupRule(ctx, "redis-egress", &ec2.SecurityGroupRuleArgs{
-			Type:            pulumi.String("egress"),
-			FromPort:        pulumi.Int(0),
-			ToPort:          pulumi.Int(0),
-			Protocol:        pulumi.String("-1"),
-			SecurityGroupId: redisSecurityGroup.ID(),
-			CidrBlocks:      pulumi.StringArray{pulumi.String("0.0.0.0/0")},
-			Description:     pulumi.String("Allow all outbound traffic"),
-		})
-		if err != nil {
-			return err
+		// The restricted egress rules are scoped to the VPC CIDR
+		strictRedisEgress := cfg.GetBool("strictRedisEgress")
+		restrictEksEgress := cfg.GetBool("restrictEksEgress")
+		var vpcCidr string
+		if strictRedisEgress || restrictEksEgress {
+			vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{Id: pulumi.StringRef(vpcId)}, pulumi.Provider(awsProvider))
+			if err != nil {
+				return err
+			}
+			vpcCidr = vpc.CidrBlock
 		}
 
-		// Allow all outbound from EKS security group
-		_, err = ec2.NewSecurityGroupRule(ctx, "eks-egress", &ec2.SecurityGroupRuleArgs{
-			Type:            pulumi.String("egress"),
-			FromPort:        pulumi.Int(0),
-			ToPort:          pulumi.Int(0),
-			Protocol:        pulumi.String("-1"),
-			SecurityGroupId: eksSecurityGroup.ID(),
-			CidrBlocks:      pulumi.StringArray{pulumi.String("0.0.0.0/0")},
-			Description:     pulumi.String("Allow all outbound traffic"),
-		})
-		if err != nil {
-			return err
+		// Redis egress: all outbound by default, or only what the cluster needs
+		if strictRedisEgress {
+			rules := strictRedisEgressRules(vpcCidr)
+			if err := validateEgressRules(rules); err != nil {
+				return err
+			}
+			for _, rule := range rules {
+				_, err = ec2.NewSecurityGroupRule(ctx, "redis-egress-"+rule.name, &ec2.SecurityGroupRuleArgs{
+					Type:            pulumi.String("egress"),
+					FromPort:        pulumi.Int(rule.port),
+					ToPort:          pulumi.Int(rule.port),
+					Protocol:        pulumi.String(rule.protocol),
+					SecurityGroupId: redisSecurityGroup.ID(),
+					CidrBlocks:      pulumi.StringArray{pulumi.String(rule.cidr)},
+					Description:     pulumi.String(rule.description),
+				}, pulumi.Provider(awsProvider))
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			_, err = ec2.NewSecurityGroupRule(ctx, "redis-egress", &ec2.SecurityGroupRuleArgs{
+				Type:            pulumi.String("egress"),
+				FromPort:        pulumi.Int(0),
+				ToPort:          pulumi.Int(0),
+				Protocol:        pulumi.String("-1"),
+				SecurityGroupId: redisSecurityGroup.ID(),
+				CidrBlocks:      pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+				Description:     pulumi.String("Allow all outbound traffic"),
+			}, pulumi.Provider(awsProvider))
+			if err != nil {
+				return err
+			}
+		}
+
+		// EKS egress: all outbound by default, or only the VPC, S3 and Redis
+		if restrictEksEgress {
+			if err := createRestrictedEksEgress(ctx, awsProvider, region, vpcCidr, eksSecurityGroup, redisSecurityGroup); err != nil {
+				return err
+			}
+		} else {
+			_, err = ec2.NewSecurityGroupRule(ctx, "eks-egress", &ec2.SecurityGroupRuleArgs{
+				Type:            pulumi.String("egress"),
+				FromPort:        pulumi.Int(0),
+				ToPort:          pulumi.Int(0),
+				Protocol:        pulumi.String("-1"),
+				SecurityGroupId: eksSecurityGroup.ID(),
+				CidrBlocks:      pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+				Description:     pulumi.String("Allow all outbound traffic"),
+			}, pulumi.Provider(awsProvider))
+			if err != nil {
+				return err
+			}
 		}
 
 		// Export outputs for use by lab stack
@@ -87,3 +160,149 @@ func main() {
 		return nil
 	})
 }
+
+// ambientRegion is the region the default AWS provider would use: aws:region, then
+// AWS_REGION, then AWS_DEFAULT_REGION; empty when none is set
+func ambientRegion(ctx *pulumi.Context) string {
+	if region := config.New(ctx, "aws").Get("region"); region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// resolveRegion defaults region to the ambient one and rejects a region that
+// disagrees with it unless allowMismatch is set
+func resolveRegion(region, ambient string, allowMismatch bool) (string, error) {
+	if region == "" {
+		if ambient == "" {
+			return "", fmt.Errorf("region: not set and no aws:region, AWS_REGION or AWS_DEFAULT_REGION to default to")
+		}
+		return ambient, nil
+	}
+	if ambient != "" && ambient != region && !allowMismatch {
+		return "", fmt.Errorf("region: %s disagrees with the ambient region %s; set allowRegionMismatch: true to deploy to %s anyway", region, ambient, region)
+	}
+	return region, nil
+}
+
+// maxSecurityGroupDescriptionLength is the AWS limit for security group descriptions
+const maxSecurityGroupDescriptionLength = 255
+
+// validateDescription checks a security group description against the AWS length limit
+func validateDescription(key, description string) error {
+	if len(description) > maxSecurityGroupDescriptionLength {
+		return fmt.Errorf("%s must be at most %d characters, got %d", key, maxSecurityGroupDescriptionLength, len(description))
+	}
+	return nil
+}
+
+// egressRule is a single-port security group egress rule
+type egressRule struct {
+	name        string
+	protocol    string
+	port        int
+	cidr        string
+	description string
+}
+
+// strictRedisEgressRules limits Redis egress to DNS and the cluster ports within the
+// VPC, and NTP to the Amazon Time Sync Service
+func strictRedisEgressRules(vpcCidr string) []egressRule {
+	return []egressRule{
+		{"dns-udp", "udp", 53, vpcCidr, "DNS to the VPC resolver"},
+		{"dns-tcp", "tcp", 53, vpcCidr, "DNS over TCP to the VPC resolver"},
+		{"ntp", "udp", 123, "169.254.169.123/32", "NTP to the Amazon Time Sync Service"},
+		{"redis", "tcp", 6379, vpcCidr, "Redis to other nodes in the VPC"},
+		{"cluster-bus", "tcp", 16379, vpcCidr, "Redis cluster bus within the VPC"},
+	}
+}
+
+// validateEgressRules rejects rules with an unknown protocol, a port out of range,
+// a malformed CIDR, or an open 0.0.0.0/0 destination
+func validateEgressRules(rules []egressRule) error {
+	for _, rule := range rules {
+		if rule.protocol != "tcp" && rule.protocol != "udp" {
+			return fmt.Errorf("egress rule %s: protocol must be tcp or udp, got %q", rule.name, rule.protocol)
+		}
+		if rule.port < 1 || rule.port > 65535 {
+			return fmt.Errorf("egress rule %s: port %d is out of range", rule.name, rule.port)
+		}
+		_, network, err := net.ParseCIDR(rule.cidr)
+		if err != nil {
+			return fmt.Errorf("egress rule %s: %q is not a valid CIDR", rule.name, rule.cidr)
+		}
+		if ones, _ := network.Mask.Size(); ones == 0 {
+			return fmt.Errorf("egress rule %s: strict egress must not allow %s", rule.name, rule.cidr)
+		}
+	}
+	return nil
+}
+
+// createRestrictedEksEgress replaces the EKS security group's allow-all egress with
+// all traffic within the VPC (nodes, pods, the EKS control plane ENIs, the VPC
+// resolver and interface endpoints such as ECR, STS and CloudWatch), HTTPS to the
+// regional S3 prefix list (ECR image layers, via a gateway endpoint) and Redis on
+// 6379 to the Redis security group. AWS publishes no prefix list for ECR, so
+// image pulls need the ECR interface endpoints in the VPC
+func createRestrictedEksEgress(ctx *pulumi.Context, awsProvider *aws.Provider, region, vpcCidr string, eksSecurityGroup, redisSecurityGroup *ec2.SecurityGroup) error {
+	if _, network, err := net.ParseCIDR(vpcCidr); err != nil {
+		return fmt.Errorf("restrictEksEgress: VPC CIDR %q is not a valid CIDR", vpcCidr)
+	} else if ones, _ := network.Mask.Size(); ones == 0 {
+		return fmt.Errorf("restrictEksEgress: restricted egress must not allow %s", vpcCidr)
+	}
+	s3PrefixList, err := ec2.LookupManagedPrefixList(ctx, &ec2.LookupManagedPrefixListArgs{
+		Name: pulumi.StringRef(fmt.Sprintf("com.amazonaws.%s.s3", region)),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return fmt.Errorf("restrictEksEgress: looking up the S3 prefix list: %w", err)
+	}
+
+	_, err = ec2.NewSecurityGroupRule(ctx, "eks-egress-vpc", &ec2.SecurityGroupRuleArgs{
+		Type:            pulumi.String("egress"),
+		FromPort:        pulumi.Int(0),
+		ToPort:          pulumi.Int(0),
+		Protocol:        pulumi.String("-1"),
+		SecurityGroupId: eksSecurityGroup.ID(),
+		CidrBlocks:      pulumi.StringArray{pulumi.String(vpcCidr)},
+		Description:     pulumi.String("All traffic within the VPC, including interface endpoints"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	_, err = ec2.NewSecurityGroupRule(ctx, "eks-egress-s3", &ec2.SecurityGroupRuleArgs{
+		Type:            pulumi.String("egress"),
+		FromPort:        pulumi.Int(443),
+		ToPort:          pulumi.Int(443),
+		Protocol:        pulumi.String("tcp"),
+		SecurityGroupId: eksSecurityGroup.ID(),
+		PrefixListIds:   pulumi.StringArray{pulumi.String(s3PrefixList.Id)},
+		Description:     pulumi.String("HTTPS to S3 for ECR image layers"),
+	}, pulumi.Provider(awsProvider))
+	if err != nil {
+		return err
+	}
+	_, err = ec2.NewSecurityGroupRule(ctx, "eks-egress-redis", &ec2.SecurityGroupRuleArgs{
+		Type:                  pulumi.String("egress"),
+		FromPort:              pulumi.Int(6379),
+		ToPort:                pulumi.Int(6379),
+		Protocol:              pulumi.String("tcp"),
+		SecurityGroupId:       eksSecurityGroup.ID(),
+		SourceSecurityGroupId: redisSecurityGroup.ID(),
+		Description:           pulumi.String("Redis to the Redis security group"),
+	}, pulumi.Provider(awsProvider))
+	return err
+}
+
+// networkTags merges the common tags with the per-resource Name and Component tags
+func networkTags(commonTags map[string]string, name string) pulumi.StringMap {
+	tags := pulumi.StringMap{}
+	for k, v := range commonTags {
+		tags[k] = pulumi.String(v)
+	}
+	tags["Name"] = pulumi.String(name)
+	tags["Component"] = pulumi.String("network")
+	return tags
+}
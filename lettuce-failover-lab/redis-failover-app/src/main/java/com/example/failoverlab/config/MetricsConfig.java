@@ -0,0 +1,29 @@
+package com.example.failoverlab.config;
+
+import io.micrometer.core.instrument.MeterRegistry;
+import lombok.extern.slf4j.Slf4j;
+import org.springframework.beans.factory.annotation.Value;
+import org.springframework.boot.actuate.autoconfigure.metrics.MeterRegistryCustomizer;
+import org.springframework.context.annotation.Bean;
+import org.springframework.context.annotation.Configuration;
+
+@Configuration
+@Slf4j
+public class MetricsConfig {
+
+    /**
+     * Tags every meter with the lab's RunId, published to CloudWatch as a dimension,
+     * so the metrics of one experiment can be told apart from the others.
+     * Left untagged when no run ID is set.
+     */
+    @Bean
+    public MeterRegistryCustomizer<MeterRegistry> runIdTag(@Value("${lab.run-id}") String runId) {
+        return registry -> {
+            if (runId.isBlank()) {
+                log.warn("LAB_RUN_ID is not set; metrics carry no RunId dimension and the lab dashboards will not show them");
+                return;
+            }
+            registry.config().commonTags("RunId", runId);
+        };
+    }
+}
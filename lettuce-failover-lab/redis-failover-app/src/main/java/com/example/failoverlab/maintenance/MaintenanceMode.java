@@ -0,0 +1,70 @@
+package com.example.failoverlab.maintenance;
+
+import lombok.extern.slf4j.Slf4j;
+import org.springframework.beans.factory.annotation.Value;
+import org.springframework.scheduling.annotation.Scheduled;
+import org.springframework.stereotype.Component;
+import software.amazon.awssdk.services.ssm.SsmClient;
+
+/**
+ * Polls the maintenance-mode SSM parameter the lab stack creates.
+ * read-only pauses every producer so the app only reads; degraded pauses the
+ * Pub/Sub and Streams workloads, leaving GET/SET running. Without a parameter
+ * name, or while it cannot be read, the last known mode stays in effect.
+ */
+@Component
+@Slf4j
+public class MaintenanceMode {
+
+    public enum Mode {
+        OFF, READ_ONLY, DEGRADED;
+
+        static Mode fromValue(String value) {
+            return switch (value) {
+                case "read-only" -> READ_ONLY;
+                case "degraded" -> DEGRADED;
+                default -> OFF;
+            };
+        }
+    }
+
+    @Value("${maintenance.parameter}")
+    private String parameterName;
+
+    private SsmClient ssmClient;
+    private volatile Mode mode = Mode.OFF;
+
+    @Scheduled(fixedDelayString = "${maintenance.poll-interval-ms}")
+    public void poll() {
+        if (parameterName == null || parameterName.isBlank()) {
+            return;
+        }
+
+        try {
+            if (ssmClient == null) {
+                ssmClient = SsmClient.create();
+            }
+            String value = ssmClient.getParameter(request -> request.name(parameterName))
+                    .parameter().value();
+            Mode next = Mode.fromValue(value);
+            if (next != mode) {
+                log.warn("Maintenance mode: {} -> {}", mode, next);
+                mode = next;
+            }
+        } catch (Exception e) {
+            log.error("Reading maintenance mode from {} failed, staying {}: {}", parameterName, mode, e.getMessage());
+        }
+    }
+
+    public Mode getMode() {
+        return mode;
+    }
+
+    public boolean writesAllowed() {
+        return mode != Mode.READ_ONLY;
+    }
+
+    public boolean isDegraded() {
+        return mode == Mode.DEGRADED;
+    }
+}
@@ -1,5 +1,6 @@
 package com.example.failoverlab.workload;
 
+import com.example.failoverlab.maintenance.MaintenanceMode;
 import com.example.failoverlab.metrics.FailoverMetrics;
 import io.lettuce.core.RedisFuture;
 import io.lettuce.core.cluster.api.async.RedisAdvancedClusterAsyncCommands;
@@ -21,6 +22,7 @@ public class GetSetWorkload {
 
     private final RedisAdvancedClusterAsyncCommands<String, String> asyncCommands;
     private final FailoverMetrics failoverMetrics;
+    private final MaintenanceMode maintenanceMode;
 
     @Value("${workload.mode}")
     private String workloadMode;
@@ -64,7 +66,7 @@ public class GetSetWorkload {
         boolean isProducer = "producer".equals(workloadMode) || "both".equals(workloadMode);
         boolean isConsumer = "consumer".equals(workloadMode) || "both".equals(workloadMode);
 
-        if (isProducer) {
+        if (isProducer && maintenanceMode.writesAllowed()) {
             executeProducer();
         }
 
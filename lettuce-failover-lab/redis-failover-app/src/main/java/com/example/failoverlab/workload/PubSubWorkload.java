@@ -1,5 +1,6 @@
 package com.example.failoverlab.workload;
 
+import com.example.failoverlab.maintenance.MaintenanceMode;
 import com.example.failoverlab.metrics.FailoverMetrics;
 import io.lettuce.core.cluster.api.async.RedisAdvancedClusterAsyncCommands;
 import io.lettuce.core.cluster.pubsub.RedisClusterPubSubListener;
@@ -24,6 +25,7 @@ public class PubSubWorkload {
     private final RedisAdvancedClusterAsyncCommands<String, String> asyncCommands;
     private final StatefulRedisClusterPubSubConnection<String, String> pubSubConnection;
     private final FailoverMetrics failoverMetrics;
+    private final MaintenanceMode maintenanceMode;
 
     @Value("${workload.mode}")
     private String workloadMode;
@@ -159,13 +161,13 @@ public class PubSubWorkload {
 
     @Scheduled(fixedRateString = "#{${workload.ops-per-second} > 0 ? (1000 / ${workload.ops-per-second}) : 1000}")
     public void executeWorkload() {
-        if (!enabled) {
+        if (!enabled || maintenanceMode.isDegraded()) {
             return;
         }
 
         boolean isProducer = "producer".equals(workloadMode) || "both".equals(workloadMode);
 
-        if (isProducer) {
+        if (isProducer && maintenanceMode.writesAllowed()) {
             publishMessage();
         }
     }
@@ -1,5 +1,6 @@
 package com.example.failoverlab.workload;
 
+import com.example.failoverlab.maintenance.MaintenanceMode;
 import com.example.failoverlab.metrics.FailoverMetrics;
 import io.lettuce.core.RedisFuture;
 import io.lettuce.core.StreamMessage;
@@ -30,6 +31,7 @@ public class StreamsWorkload {
     private final RedisAdvancedClusterAsyncCommands<String, String> asyncCommands;
     private final RedisAdvancedClusterCommands<String, String> syncCommands;
     private final FailoverMetrics failoverMetrics;
+    private final MaintenanceMode maintenanceMode;
 
     @Value("${workload.mode}")
     private String workloadMode;
@@ -113,14 +115,14 @@ public class StreamsWorkload {
 
     @Scheduled(fixedRateString = "#{${workload.ops-per-second} > 0 ? (1000 / ${workload.ops-per-second}) : 1000}")
     public void executeWorkload() {
-        if (!enabled) {
+        if (!enabled || maintenanceMode.isDegraded()) {
             return;
         }
 
         boolean isProducer = "producer".equals(workloadMode) || "both".equals(workloadMode);
         boolean isConsumer = "consumer".equals(workloadMode) || "both".equals(workloadMode);
 
-        if (isProducer) {
+        if (isProducer && maintenanceMode.writesAllowed()) {
             addToStream();
         }
 
@@ -0,0 +1,23 @@
+#!/bin/bash
+set -e
+
+# Flip the Failover Lab app's maintenance mode
+# Usage: ./set-maintenance-mode.sh off|read-only|degraded
+
+PARAMETER_NAME="/failover-lab/maintenance-mode"
+AWS_REGION="${AWS_REGION:-us-east-1}"
+MODE="$1"
+
+case "${MODE}" in
+    off|read-only|degraded)
+        ;;
+    *)
+        echo "Usage: $0 off|read-only|degraded"
+        exit 1
+        ;;
+esac
+
+PREVIOUS=$(aws ssm get-parameter --region "${AWS_REGION}" --name "${PARAMETER_NAME}" --query Parameter.Value --output text)
+aws ssm put-parameter --region "${AWS_REGION}" --name "${PARAMETER_NAME}" --value "${MODE}" --overwrite > /dev/null
+
+echo "Maintenance mode: ${PREVIOUS} -> ${MODE} ($(date -u +%Y-%m-%dT%H:%M:%SZ))"